@@ -0,0 +1,312 @@
+// Package accesspath analyzes how a user accessed the device portal (i.e. which hostname they used
+// in their web browser), so that pages can explain whether that hostname will keep working and
+// suggest alternative URLs for the machine
+package accesspath
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MDNSHostnamePrefix is the prefix of the machine-specific mDNS hostname of each machine, which
+	// is followed by the machine name.
+	MDNSHostnamePrefix = "openuc2-"
+	// GenericMDNSHostname is the mDNS hostname which can refer to any machine.
+	GenericMDNSHostname = "openuc2"
+	// HotspotDomain is the domain used for machines by the DNS server on each machine's Wi-Fi
+	// hotspot and Ethernet port.
+	HotspotDomain = "uc2"
+	// MDNSDomain is the domain used for mDNS hostnames.
+	MDNSDomain = "local"
+)
+
+// Kind
+
+// A Kind describes what kind of hostname was used to access the device portal.
+type Kind string
+
+const (
+	// KindHotspot is a hostname in the .uc2 domain, which only works over direct connections to a
+	// machine (i.e. to its Wi-Fi hotspot or its Ethernet port).
+	KindHotspot Kind = "hotspot"
+	// KindMDNS is an mDNS hostname in the .local domain.
+	KindMDNS Kind = "mdns"
+	// KindIP is a raw IPv4 or IPv6 address.
+	KindIP Kind = "ip"
+	// KindLocalhost is a hostname (or loopback address) for the machine itself.
+	KindLocalhost Kind = "localhost"
+	// KindOther is any other hostname, e.g. from a conventional DNS server.
+	KindOther Kind = "other"
+)
+
+// AccessPath
+
+// An AccessPath describes the URL which was used to access the device portal.
+type AccessPath struct {
+	// Scheme is the URL scheme, either http or https.
+	Scheme string
+	// Hostname is the hostname or IP address, without any port or IPv6 brackets.
+	Hostname string
+	// Port is the port, if it was explicitly specified.
+	Port string
+	// BasePath is the path prefix which the device portal is served under, without a trailing
+	// slash.
+	BasePath string
+	// Kind is the kind of hostname.
+	Kind Kind
+	// MachineSpecific is whether the hostname can only refer to the current machine, rather than
+	// to whichever machine happens to respond to it (e.g. openuc2.local).
+	MachineSpecific bool
+	// Alternatives are URLs which can be used to access the current machine, including the current
+	// URL.
+	Alternatives []Alternative
+}
+
+// New analyzes an access path from a URL scheme and a host (e.g. from an HTTP request's Host
+// header), for the device portal served under the base path on the machine with the specified
+// machine name.
+func New(scheme, host, basePath, machineName string) (a AccessPath, err error) {
+	a.Scheme = "http"
+	if strings.EqualFold(scheme, "https") {
+		a.Scheme = "https"
+	}
+	if a.Hostname, a.Port, err = splitHost(host); err != nil {
+		return AccessPath{}, err
+	}
+	a.BasePath = strings.TrimSuffix(basePath, "/")
+	a.Kind, a.MachineSpecific = classify(a.Hostname, machineName)
+	a.Alternatives = a.alternatives(machineName)
+	return a, nil
+}
+
+// FromRequest analyzes the access path of an HTTP request, for the device portal served under the
+// base path on the machine with the specified machine name. If useForwarded is true, the access
+// path is determined from the Forwarded header (RFC 7239) or the X-Forwarded-Host and
+// X-Forwarded-Proto headers, if they're present; that should only be done for requests from trusted
+// reverse-proxies, since those headers can be spoofed.
+func FromRequest(
+	r *http.Request, basePath, machineName string, useForwarded bool,
+) (AccessPath, error) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if useForwarded {
+		forwardedScheme, forwardedHost := parseForwarded(r.Header)
+		if forwardedScheme != "" {
+			scheme = forwardedScheme
+		}
+		if forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	a, err := New(scheme, host, basePath, machineName)
+	return a, errors.Wrap(err, "couldn't analyze access path of request")
+}
+
+// Host returns the hostname and port in the form used in URLs.
+func (a AccessPath) Host() string {
+	return joinHost(a.Hostname, a.Port)
+}
+
+// URL returns the URL of the path (relative to the base path) on the access path.
+func (a AccessPath) URL(path string) string {
+	return (&url.URL{Scheme: a.Scheme, Host: a.Host(), Path: a.BasePath + path}).String()
+}
+
+func (a AccessPath) IsHotspot() bool {
+	return a.Kind == KindHotspot
+}
+
+func (a AccessPath) IsMDNS() bool {
+	return a.Kind == KindMDNS
+}
+
+func (a AccessPath) IsIP() bool {
+	return a.Kind == KindIP
+}
+
+func (a AccessPath) IsLocalhost() bool {
+	return a.Kind == KindLocalhost
+}
+
+// WithScheme returns a copy of the access path (including its alternatives) with a different URL
+// scheme and port, e.g. for the same access path on an HTTPS server.
+func (a AccessPath) WithScheme(scheme, port string) AccessPath {
+	a.Scheme = scheme
+	a.Port = port
+	alternatives := make([]Alternative, 0, len(a.Alternatives))
+	for _, alternative := range a.Alternatives {
+		alternative.URL = a.alternativeURL(alternative.Hostname)
+		alternatives = append(alternatives, alternative)
+	}
+	a.Alternatives = alternatives
+	return a
+}
+
+// Alternative returns the alternative access path of the specified kind and machine-specificity,
+// or the zero value if there is no such alternative (so that it can be used in templates).
+func (a AccessPath) Alternative(kind Kind, machineSpecific bool) Alternative {
+	for _, alternative := range a.Alternatives {
+		if alternative.Kind == kind && alternative.MachineSpecific == machineSpecific {
+			return alternative
+		}
+	}
+	return Alternative{}
+}
+
+// Alternative
+
+// An Alternative is a URL which can be used to access the current machine.
+type Alternative struct {
+	// Hostname is the hostname of the alternative URL.
+	Hostname string
+	// URL is the URL of the device portal's home page at the hostname.
+	URL string
+	// Kind is the kind of hostname.
+	Kind Kind
+	// MachineSpecific is whether the hostname can only refer to the current machine.
+	MachineSpecific bool
+	// Current is whether the hostname is the one which is currently being used.
+	Current bool
+}
+
+// Hostnames returns the hostnames which can be used to access the machine with the specified
+// machine name, with machine-specific hostnames first.
+func Hostnames(machineName string) []string {
+	hostnames := make([]string, 0)
+	if machineName != "" {
+		hostnames = append(
+			hostnames,
+			MDNSHostnamePrefix+machineName+"."+MDNSDomain,
+			machineName+"."+HotspotDomain,
+		)
+	}
+	return append(hostnames, GenericMDNSHostname+"."+MDNSDomain)
+}
+
+func (a AccessPath) alternatives(machineName string) []Alternative {
+	hostnames := Hostnames(machineName)
+	alternatives := make([]Alternative, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		kind, machineSpecific := classify(hostname, machineName)
+		alternatives = append(alternatives, Alternative{
+			Hostname:        hostname,
+			URL:             a.alternativeURL(hostname),
+			Kind:            kind,
+			MachineSpecific: machineSpecific,
+			Current:         strings.EqualFold(hostname, a.Hostname),
+		})
+	}
+	return alternatives
+}
+
+// alternativeURL returns the URL of the home page at the hostname.
+func (a AccessPath) alternativeURL(hostname string) string {
+	u := url.URL{Scheme: a.Scheme, Host: joinHost(hostname, a.Port), Path: a.BasePath + "/"}
+	return u.String()
+}
+
+// Hostnames
+
+// splitHost splits a host (which may have a port, and which may be a bracketed IPv6 address) into
+// a hostname and a port.
+func splitHost(host string) (hostname, port string, err error) {
+	if host == "" {
+		return "", "", errors.New("host is empty")
+	}
+	if hostname, port, err = net.SplitHostPort(host); err != nil {
+		// The host doesn't have a port
+		hostname, port = host, ""
+		if strings.HasPrefix(hostname, "[") && strings.HasSuffix(hostname, "]") {
+			hostname = hostname[1 : len(hostname)-1]
+		}
+	}
+	if strings.ContainsAny(hostname, "[]") || hostname == "" {
+		return "", "", errors.Errorf("unable to split host '%s' into a hostname and a port", host)
+	}
+	if strings.Contains(hostname, ":") || strings.HasPrefix(host, "[") {
+		// Only IPv6 addresses may contain colons, and only they may be enclosed in brackets
+		if addr, err := netip.ParseAddr(hostname); err != nil || !addr.Is6() {
+			return "", "", errors.Errorf("unable to split host '%s' into a hostname and a port", host)
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(hostname, ".")), port, nil
+}
+
+func joinHost(hostname, port string) string {
+	if port != "" {
+		return net.JoinHostPort(hostname, port)
+	}
+	if strings.Contains(hostname, ":") {
+		return "[" + hostname + "]"
+	}
+	return hostname
+}
+
+// classify determines the kind of the hostname and whether it's specific to the machine with the
+// specified machine name.
+func classify(hostname, machineName string) (kind Kind, machineSpecific bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if addr, err := netip.ParseAddr(hostname); err == nil {
+		if addr.IsLoopback() {
+			return KindLocalhost, true
+		}
+		return KindIP, true
+	}
+	label, domain, _ := strings.Cut(hostname, ".")
+	switch {
+	case hostname == "localhost" || domain == "localhost":
+		return KindLocalhost, true
+	case domain == MDNSDomain:
+		return KindMDNS, strings.HasPrefix(label, MDNSHostnamePrefix)
+	case domain == HotspotDomain:
+		return KindHotspot, machineName != "" && strings.EqualFold(label, machineName)
+	default:
+		return KindOther, false
+	}
+}
+
+// Forwarded headers
+
+// parseForwarded returns the original URL scheme and host of a request forwarded by a
+// reverse-proxy, from either the Forwarded header (RFC 7239) or the X-Forwarded-Proto and
+// X-Forwarded-Host headers. If there are multiple values (e.g. from a chain of reverse-proxies),
+// the last value is used, since each reverse-proxy appends its value to any values in the request
+// which it received: earlier values may have been set by the client, so they can't be trusted.
+func parseForwarded(h http.Header) (scheme, host string) {
+	if forwarded := lastValue(h.Values("Forwarded")); forwarded != "" {
+		for pair := range strings.SplitSeq(forwarded, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "proto":
+				scheme = value
+			case "host":
+				host = value
+			}
+		}
+		return scheme, host
+	}
+	return lastValue(h.Values("X-Forwarded-Proto")), lastValue(h.Values("X-Forwarded-Host"))
+}
+
+// lastValue returns the last non-empty element of the comma-separated lists in the values of a
+// header.
+func lastValue(values []string) (last string) {
+	for _, value := range values {
+		for element := range strings.SplitSeq(value, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				last = element
+			}
+		}
+	}
+	return last
+}
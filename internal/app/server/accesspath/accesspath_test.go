@@ -0,0 +1,383 @@
+package accesspath
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testMachineName = "metal-slope-23501"
+
+func TestSplitHost(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		host     string
+		hostname string
+		port     string
+		err      bool
+	}{
+		{host: "192.168.1.10", hostname: "192.168.1.10"},
+		{host: "192.168.1.10:3001", hostname: "192.168.1.10", port: "3001"},
+		{host: "[fe80::1]:80", hostname: "fe80::1", port: "80"},
+		{host: "[fe80::1]", hostname: "fe80::1"},
+		{host: "fe80::1", hostname: "fe80::1"},
+		{host: "openUC2.local.", hostname: "openuc2.local"},
+		{host: "openuc2.local.:80", hostname: "openuc2.local", port: "80"},
+		{host: "", err: true},
+		{host: "[]", err: true},
+		{host: "[]:80", err: true},
+		{host: "[openuc2.local]", err: true},
+		{host: "[192.168.1.10]:80", err: true},
+		{host: "[fe80::1", err: true},
+		{host: "fe80::1]:80", err: true},
+		{host: "openuc2:local:80", err: true},
+	} {
+		t.Run(tc.host, func(t *testing.T) {
+			t.Parallel()
+			hostname, port, err := splitHost(tc.host)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got hostname %q and port %q", hostname, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if hostname != tc.hostname || port != tc.port {
+				t.Errorf(
+					"got hostname %q and port %q, expected hostname %q and port %q",
+					hostname, port, tc.hostname, tc.port,
+				)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		hostname        string
+		machineName     string
+		kind            Kind
+		machineSpecific bool
+	}{
+		{
+			hostname: testMachineName + ".uc2", machineName: testMachineName,
+			kind: KindHotspot, machineSpecific: true,
+		},
+		{
+			hostname: "METAL-SLOPE-23501.uc2.", machineName: testMachineName,
+			kind: KindHotspot, machineSpecific: true,
+		},
+		{hostname: "openuc2.uc2", machineName: testMachineName, kind: KindHotspot},
+		{hostname: testMachineName + ".uc2", kind: KindHotspot},
+		{
+			hostname: "openuc2-" + testMachineName + ".local", machineName: testMachineName,
+			kind: KindMDNS, machineSpecific: true,
+		},
+		{hostname: "openuc2.local", machineName: testMachineName, kind: KindMDNS},
+		{hostname: "raspberrypi.local", machineName: testMachineName, kind: KindMDNS},
+		{hostname: "192.168.1.10", kind: KindIP, machineSpecific: true},
+		{hostname: "fe80::1", kind: KindIP, machineSpecific: true},
+		{hostname: "127.0.0.1", kind: KindLocalhost, machineSpecific: true},
+		{hostname: "::1", kind: KindLocalhost, machineSpecific: true},
+		{hostname: "localhost", kind: KindLocalhost, machineSpecific: true},
+		{hostname: "LOCALHOST.", kind: KindLocalhost, machineSpecific: true},
+		{hostname: "portal.localhost", kind: KindLocalhost, machineSpecific: true},
+		{hostname: "example.com", machineName: testMachineName, kind: KindOther},
+		{hostname: "uc2", machineName: testMachineName, kind: KindOther},
+	} {
+		t.Run(tc.hostname, func(t *testing.T) {
+			t.Parallel()
+			kind, machineSpecific := classify(tc.hostname, tc.machineName)
+			if kind != tc.kind || machineSpecific != tc.machineSpecific {
+				t.Errorf(
+					"got %q (machine-specific: %t), expected %q (machine-specific: %t)",
+					kind, machineSpecific, tc.kind, tc.machineSpecific,
+				)
+			}
+		})
+	}
+}
+
+func TestParseForwarded(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		scheme string
+		host   string
+	}{
+		{name: "none", header: http.Header{}},
+		{
+			name:   "forwarded",
+			header: http.Header{"Forwarded": {"for=192.0.2.60;proto=https;host=openuc2.local"}},
+			scheme: "https",
+			host:   "openuc2.local",
+		},
+		{
+			name: "forwarded quoted",
+			header: http.Header{
+				"Forwarded": {`for="[2001:db8:cafe::17]:4711"; Proto="https"; Host="[fe80::1]:3443"`},
+			},
+			scheme: "https",
+			host:   "[fe80::1]:3443",
+		},
+		{
+			name: "forwarded multiple hops",
+			header: http.Header{
+				"Forwarded": {"proto=http;host=proxy.internal, proto=https;host=openuc2.local"},
+			},
+			scheme: "https",
+			host:   "openuc2.local",
+		},
+		{
+			name: "forwarded multiple headers",
+			header: http.Header{
+				"Forwarded": {"proto=http;host=proxy.internal", "proto=https;host=openuc2.local"},
+			},
+			scheme: "https",
+			host:   "openuc2.local",
+		},
+		{
+			// The client set its own Forwarded header, which the reverse-proxy appended to
+			name: "forwarded spoofed",
+			header: http.Header{
+				"Forwarded": {`proto=https;host="evil.example", for=192.168.1.10;host=openuc2.local`},
+			},
+			host: "openuc2.local",
+		},
+		{
+			name:   "forwarded without host",
+			header: http.Header{"Forwarded": {"for=192.0.2.60;proto=https"}},
+			scheme: "https",
+		},
+		{
+			name: "forwarded precedence",
+			header: http.Header{
+				"Forwarded":         {"host=openuc2.local"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"proxy.internal"},
+			},
+			host: "openuc2.local",
+		},
+		{
+			name: "x-forwarded",
+			header: http.Header{
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"openuc2.local:3443"},
+			},
+			scheme: "https",
+			host:   "openuc2.local:3443",
+		},
+		{
+			name: "x-forwarded multiple hops",
+			header: http.Header{
+				"X-Forwarded-Proto": {"http, https"},
+				"X-Forwarded-Host":  {" proxy.internal , openuc2.local "},
+			},
+			scheme: "https",
+			host:   "openuc2.local",
+		},
+		{
+			// The client set its own X-Forwarded-* headers, which the reverse-proxy appended to
+			name: "x-forwarded spoofed",
+			header: http.Header{
+				"X-Forwarded-Proto": {"https", "http"},
+				"X-Forwarded-Host":  {"evil.example, other.example", "openuc2.local"},
+			},
+			scheme: "http",
+			host:   "openuc2.local",
+		},
+		{
+			name: "x-forwarded empty elements",
+			header: http.Header{
+				"X-Forwarded-Proto": {"https,"},
+				"X-Forwarded-Host":  {"openuc2.local, "},
+			},
+			scheme: "https",
+			host:   "openuc2.local",
+		},
+		{
+			name:   "x-forwarded host only",
+			header: http.Header{"X-Forwarded-Host": {"openuc2.local"}},
+			host:   "openuc2.local",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			scheme, host := parseForwarded(tc.header)
+			if scheme != tc.scheme || host != tc.host {
+				t.Errorf(
+					"got scheme %q and host %q, expected scheme %q and host %q",
+					scheme, host, tc.scheme, tc.host,
+				)
+			}
+		})
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name         string
+		host         string
+		basePath     string
+		machineName  string
+		alternatives []Alternative
+	}{
+		{
+			name:        "default port",
+			host:        "openuc2.local",
+			machineName: testMachineName,
+			alternatives: []Alternative{
+				{
+					Hostname: "openuc2-" + testMachineName + ".local",
+					URL:      "http://openuc2-" + testMachineName + ".local/",
+					Kind:     KindMDNS, MachineSpecific: true,
+				},
+				{
+					Hostname: testMachineName + ".uc2",
+					URL:      "http://" + testMachineName + ".uc2/",
+					Kind:     KindHotspot, MachineSpecific: true,
+				},
+				{
+					Hostname: "openuc2.local", URL: "http://openuc2.local/", Kind: KindMDNS,
+					Current: true,
+				},
+			},
+		},
+		{
+			name:        "base path and port",
+			host:        testMachineName + ".uc2:3001",
+			basePath:    "/portal/",
+			machineName: testMachineName,
+			alternatives: []Alternative{
+				{
+					Hostname: "openuc2-" + testMachineName + ".local",
+					URL:      "http://openuc2-" + testMachineName + ".local:3001/portal/",
+					Kind:     KindMDNS, MachineSpecific: true,
+				},
+				{
+					Hostname: testMachineName + ".uc2",
+					URL:      "http://" + testMachineName + ".uc2:3001/portal/",
+					Kind:     KindHotspot, MachineSpecific: true, Current: true,
+				},
+				{
+					Hostname: "openuc2.local", URL: "http://openuc2.local:3001/portal/",
+					Kind: KindMDNS,
+				},
+			},
+		},
+		{
+			name: "no machine name",
+			host: "[fe80::1]:3001",
+			alternatives: []Alternative{
+				{Hostname: "openuc2.local", URL: "http://openuc2.local:3001/", Kind: KindMDNS},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a, err := New("http", tc.host, tc.basePath, tc.machineName)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(a.Alternatives, tc.alternatives) {
+				t.Errorf("got alternatives %+v, expected %+v", a.Alternatives, tc.alternatives)
+			}
+		})
+	}
+}
+
+func TestAlternativeWithoutMachineName(t *testing.T) {
+	t.Parallel()
+	a, err := New("http", "openuc2.local", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Templates check the URL to decide whether to link to an alternative
+	if alternative := a.Alternative(KindMDNS, true); alternative != (Alternative{}) {
+		t.Errorf("got machine-specific mDNS alternative %+v, expected zero value", alternative)
+	}
+	if alternative := a.Alternative(KindHotspot, true); alternative != (Alternative{}) {
+		t.Errorf("got hotspot alternative %+v, expected zero value", alternative)
+	}
+	if alternative := a.Alternative(KindMDNS, false); alternative.URL != "http://openuc2.local/" {
+		t.Errorf("got generic mDNS alternative %+v, expected URL http://openuc2.local/", alternative)
+	}
+}
+
+func TestWithScheme(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		host     string
+		basePath string
+		scheme   string
+		port     string
+		url      string
+		urls     []string
+	}{
+		{
+			name:   "https default port",
+			host:   "openuc2.local:3001",
+			scheme: "https",
+			url:    "https://openuc2.local/",
+			urls: []string{
+				"https://openuc2-" + testMachineName + ".local/",
+				"https://" + testMachineName + ".uc2/",
+				"https://openuc2.local/",
+			},
+		},
+		{
+			name:     "https port with base path",
+			host:     "openuc2.local",
+			basePath: "/portal",
+			scheme:   "https",
+			port:     "3443",
+			url:      "https://openuc2.local:3443/portal/",
+			urls: []string{
+				"https://openuc2-" + testMachineName + ".local:3443/portal/",
+				"https://" + testMachineName + ".uc2:3443/portal/",
+				"https://openuc2.local:3443/portal/",
+			},
+		},
+		{
+			name:   "ipv6",
+			host:   "[fe80::1]",
+			scheme: "https",
+			port:   "3443",
+			url:    "https://[fe80::1]:3443/",
+			urls: []string{
+				"https://openuc2-" + testMachineName + ".local:3443/",
+				"https://" + testMachineName + ".uc2:3443/",
+				"https://openuc2.local:3443/",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a, err := New("http", tc.host, tc.basePath, testMachineName)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			original := a.Alternatives[0].URL
+			b := a.WithScheme(tc.scheme, tc.port)
+			if url := b.URL("/"); url != tc.url {
+				t.Errorf("got URL %q, expected %q", url, tc.url)
+			}
+			urls := make([]string, 0, len(b.Alternatives))
+			for _, alternative := range b.Alternatives {
+				urls = append(urls, alternative.URL)
+			}
+			if !reflect.DeepEqual(urls, tc.urls) {
+				t.Errorf("got alternative URLs %q, expected %q", urls, tc.urls)
+			}
+			if a.Alternatives[0].URL != original {
+				t.Errorf("original alternatives were modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/clientcache"
+	"github.com/sargassum-world/godest/marshaling"
+)
+
+// RistrettoCache is a [clientcache.Cache] which behaves like the one made by
+// [clientcache.NewRistrettoCache], except that it also exposes the metrics of the underlying
+// ristretto cache.
+type RistrettoCache struct {
+	cache     *ristretto.Cache
+	marshaler marshaling.Marshaler
+}
+
+var _ clientcache.Cache = (*RistrettoCache)(nil)
+
+func NewRistrettoCache(config ristretto.Config) (*RistrettoCache, error) {
+	cache, err := ristretto.NewCache(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &RistrettoCache{
+		cache:     cache,
+		marshaler: marshaling.MessagePack{},
+	}, nil
+}
+
+// Metrics returns the metrics of the cache, or nil if metrics are disabled in the cache config.
+func (c *RistrettoCache) Metrics() *ristretto.Metrics {
+	return c.cache.Metrics
+}
+
+func computeCacheCost(costWeight float32, bytes []byte) int64 {
+	return int64(float64(costWeight) * float64(len(bytes)))
+}
+
+func (c *RistrettoCache) SetEntry(
+	key string, value any, costWeight float32, ttl time.Duration,
+) error {
+	marshaled, err := c.marshaler.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't marshal value for key %s", key)
+	}
+	if ttl < 0 {
+		c.cache.Set(key, marshaled, computeCacheCost(costWeight, marshaled))
+	} else {
+		c.cache.SetWithTTL(key, marshaled, computeCacheCost(costWeight, marshaled), ttl)
+	}
+	return nil
+}
+
+func (c *RistrettoCache) UnsetEntry(key string) {
+	c.cache.Del(key)
+}
+
+// nonexistentValue is a tombstone indicating that a key has no value.
+type nonexistentValue struct{}
+
+func (c *RistrettoCache) SetNonexistentEntry(key string, cost float32, ttl time.Duration) {
+	if ttl < 0 {
+		c.cache.Set(key, nonexistentValue{}, int64(cost))
+	} else {
+		c.cache.SetWithTTL(key, nonexistentValue{}, int64(cost), ttl)
+	}
+}
+
+func (c *RistrettoCache) GetEntry(key string, value any) (cacheHit, valueExists bool, err error) {
+	entryRaw, hasKey := c.cache.Get(key)
+	if !hasKey {
+		return false, false, nil
+	}
+
+	switch marshaled := entryRaw.(type) {
+	default:
+		return true, false, errors.Errorf("cache entry %s has unexpected type %T", key, entryRaw)
+	case nonexistentValue:
+		return true, false, nil
+	case []byte:
+		if err := c.marshaler.Unmarshal(marshaled, value); err != nil {
+			return true, true, errors.Wrapf(err, "couldn't unmarshal value for key %s", key)
+		}
+		return true, true, nil
+	}
+}
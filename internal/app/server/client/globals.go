@@ -2,18 +2,28 @@
 package client
 
 import (
+	"github.com/dgraph-io/ristretto"
 	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest"
 	"github.com/sargassum-world/godest/clientcache"
+	"github.com/sargassum-world/godest/turbostreams"
 
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
 	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/certs"
+	"github.com/openUC2/device-portal/internal/clients/health"
 	"github.com/openUC2/device-portal/internal/clients/machinename"
+	"github.com/openUC2/device-portal/internal/clients/mdns"
 	"github.com/openUC2/device-portal/internal/clients/templates"
 )
 
 type BaseGlobals struct {
 	Templates *templates.Client
 	Cache     clientcache.Cache
+	// CacheMetrics are the metrics of the cache, which are nil unless cache metrics are enabled.
+	CacheMetrics *ristretto.Metrics
+	TSBroker     *turbostreams.Broker
 
 	Logger godest.Logger
 }
@@ -23,6 +33,10 @@ type Globals struct {
 	Base   *BaseGlobals
 
 	MachineName *machinename.Client
+	Apps        *apps.Client
+	Health      *health.Client
+	MDNS        *mdns.Client
+	Certs       *certs.Client
 }
 
 func NewBaseGlobals(config conf.Config, l godest.Logger) (g *BaseGlobals, err error) {
@@ -32,10 +46,14 @@ func NewBaseGlobals(config conf.Config, l godest.Logger) (g *BaseGlobals, err er
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't set up templates config")
 	}
-	g.Templates = templates.NewClient(templatesConfig)
-	if g.Cache, err = clientcache.NewRistrettoCache(config.Cache); err != nil {
+	g.Templates = templates.NewClient(templatesConfig, l)
+	cache, err := NewRistrettoCache(config.Cache)
+	if err != nil {
 		return nil, errors.Wrap(err, "couldn't set up client cache")
 	}
+	g.Cache = cache
+	g.CacheMetrics = cache.Metrics()
+	g.TSBroker = turbostreams.NewBroker(l)
 	g.Logger = l
 	return g, nil
 }
@@ -55,5 +73,72 @@ func NewGlobals(config conf.Config, l godest.Logger) (g *Globals, err error) {
 	}
 	g.MachineName = machinename.NewClient(machineNameConfig, g.Base.Cache, l)
 
+	appsConfig, err := apps.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't set up apps config")
+	}
+	g.Apps = apps.NewClient(appsConfig, g.Base.Cache, l)
+
+	healthConfig, err := health.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't set up health config")
+	}
+	g.Health = health.NewClient(healthConfig, g.Apps, g.Base.Cache, l)
+
+	mdnsConfig, err := mdns.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't set up mDNS config")
+	}
+	if mdnsConfig.Port == 0 {
+		mdnsConfig.Port = config.HTTP.Port
+	}
+	mdnsConfig.Path = config.HTTP.BasePath + "/"
+	mdnsConfig.Version = config.Version
+	g.MDNS = mdns.NewClient(mdnsConfig, g.MachineName, g.Apps, g.Base.Cache, l)
+
+	certsConfig, err := g.getCertsConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't set up certificates config")
+	}
+	g.Certs = certs.NewClient(certsConfig, g.MachineName, l)
+
 	return g, nil
 }
+
+func (g *Globals) getCertsConfig() (certs.Config, error) {
+	c, err := certs.GetConfig()
+	if err != nil {
+		return certs.Config{}, err
+	}
+	mdnsHostname := g.MDNS.Config.Hostname + "." + accesspath.MDNSDomain
+	c.Hostnames = func(machineName string) []string {
+		return append(accesspath.Hostnames(machineName), mdnsHostname)
+	}
+	return c, nil
+}
+
+// Reload rebuilds the configs of clients whose settings can be changed without a restart (i.e. the
+// machine name, the templates path, and the certificate files), e.g. after the environment
+// variables of settings were changed by re-reading the config file. Cache entries made stale by the
+// new configs are flushed, and the mDNS advertisement is refreshed to announce any new machine
+// name.
+func (g *Globals) Reload() error {
+	machineNameConfig, err := machinename.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "couldn't reload machine-name config")
+	}
+	templatesConfig, err := templates.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "couldn't reload templates config")
+	}
+	certsConfig, err := g.getCertsConfig()
+	if err != nil {
+		return errors.Wrap(err, "couldn't reload certificates config")
+	}
+
+	g.MachineName.Reconfigure(machineNameConfig)
+	g.Base.Templates.Reconfigure(templatesConfig)
+	g.Certs.Reconfigure(certsConfig)
+	g.MDNS.Refresh()
+	return nil
+}
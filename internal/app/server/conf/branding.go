@@ -0,0 +1,44 @@
+package conf
+
+import (
+	"github.com/sargassum-world/godest/env"
+
+	"github.com/openUC2/device-portal/internal/clients/templates"
+)
+
+const brandingEnvPrefix = "BRANDING_"
+
+// Default values of branding settings, which are specific to ImSwitch OS.
+const (
+	DefaultBrandingName            = "ImSwitch OS"
+	DefaultBrandingThemeColor      = "#8e7dc4"
+	DefaultBrandingBackgroundColor = "#151d28"
+)
+
+// BrandingConfig configures how the device portal presents the product it's part of.
+type BrandingConfig struct {
+	// StaticPaths are the directories of custom static assets (e.g. logos and icons), from the
+	// highest priority to the lowest priority; assets in each directory override assets at the same
+	// paths in the directories after it, and in the built-in static assets.
+	StaticPaths []string
+	// Name is the name of the product, e.g. in the web app manifest.
+	Name string
+	// ShortName is the name of the product where there's little space, e.g. under the app's icon on
+	// a home screen.
+	ShortName string
+	// ThemeColor is the CSS color which browsers may use for the UI around pages.
+	ThemeColor string
+	// BackgroundColor is the CSS color which browsers may show before the app's stylesheets load.
+	BackgroundColor string
+}
+
+func getBrandingConfig() (c BrandingConfig, err error) {
+	c.StaticPaths = templates.ParsePaths(env.GetString(brandingEnvPrefix+"STATICPATH", ""))
+	c.Name = env.GetString(brandingEnvPrefix+"NAME", DefaultBrandingName)
+	c.ShortName = env.GetString(brandingEnvPrefix+"SHORTNAME", c.Name)
+	c.ThemeColor = env.GetString(brandingEnvPrefix+"THEMECOLOR", DefaultBrandingThemeColor)
+	c.BackgroundColor = env.GetString(
+		brandingEnvPrefix+"BACKGROUNDCOLOR", DefaultBrandingBackgroundColor,
+	)
+	return c, nil
+}
@@ -1,27 +1,56 @@
-// Package conf supports environment variable-based application configuration
+// Package conf supports environment variable-based application configuration, with an optional
+// config file whose values are layered beneath environment variables
 package conf
 
 import (
 	"github.com/dgraph-io/ristretto"
 	"github.com/pkg/errors"
+
+	"github.com/openUC2/device-portal/internal/app/server/logging"
 )
 
 type Config struct {
-	Cache ristretto.Config
-	HTTP  HTTPConfig
-}
+	// Version is the version of the device-portal program, reported by the API.
+	Version string
 
-type HTTPConfig struct {
-	Port      int
-	BasePath  string
-	GzipLevel int
+	Log       logging.Config
+	Cache     ristretto.Config
+	HTTP      HTTPConfig
+	HTTPS     HTTPSConfig
+	Metrics   MetricsConfig
+	RateLimit RateLimitConfig
+	Branding  BrandingConfig
 }
 
 func GetConfig() (c Config, err error) {
+	c.Log, err = logging.GetConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make logging config")
+	}
 	c.Cache, err = getCacheConfig()
 	if err != nil {
 		return Config{}, errors.Wrap(err, "couldn't make cache config")
 	}
+	c.HTTP, err = getHTTPConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make http config")
+	}
+	c.HTTPS, err = getHTTPSConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make https config")
+	}
+	c.Metrics, err = getMetricsConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make metrics config")
+	}
+	c.RateLimit, err = getRateLimitConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make rate limit config")
+	}
+	c.Branding, err = getBrandingConfig()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make branding config")
+	}
 
 	return c, nil
 }
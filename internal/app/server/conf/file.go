@@ -0,0 +1,227 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a TOML or YAML config file, with a section for each group of settings (e.g. [http]).
+type File struct {
+	Path string
+	// Values are the values of settings in the config file, keyed by setting key, in the form used
+	// in the settings' environment variables.
+	Values map[string]string
+}
+
+// LoadFile loads the config file at the path, which must have a .toml, .yaml, or .yml file
+// extension.
+func LoadFile(path string) (f File, err error) {
+	f.Path = path
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return File{}, errors.Wrapf(err, "couldn't read config file %s", path)
+	}
+	var sections map[string]any
+	switch ext := filepath.Ext(path); ext {
+	default:
+		return File{}, errors.Errorf("config file %s has unknown file extension %s", path, ext)
+	case ".toml":
+		if _, err = toml.Decode(string(raw), &sections); err != nil {
+			return File{}, errors.Wrapf(err, "couldn't parse config file %s as TOML", path)
+		}
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(raw, &sections); err != nil {
+			return File{}, errors.Wrapf(err, "couldn't parse config file %s as YAML", path)
+		}
+	}
+
+	f.Values = make(map[string]string)
+	for _, section := range slices.Sorted(maps.Keys(sections)) {
+		values, ok := sections[section].(map[string]any)
+		if !ok {
+			return File{}, errors.Errorf("config file %s: %s must be a section", path, section)
+		}
+		for _, name := range slices.Sorted(maps.Keys(values)) {
+			key := section + "." + name
+			s, ok := LookupSetting(key)
+			if !ok {
+				return File{}, errors.Errorf("config file %s: unknown setting %s", path, key)
+			}
+			if f.Values[key], err = s.FromFile(values[name]); err != nil {
+				return File{}, errors.Wrapf(err, "config file %s", path)
+			}
+		}
+	}
+	return f, nil
+}
+
+// Layering
+
+// A Source is the layer of configuration which the value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+var (
+	initialEnv     map[string]string
+	initialEnvOnce sync.Once
+)
+
+// Apply sets the environment variables of all settings, so that the config file takes precedence
+// over default values, environment variables take precedence over the config file, and flags take
+// precedence over environment variables. flagValues are the values of flags which were set, keyed
+// by setting key. Only the environment variables which were set before the first call of Apply
+// are considered, so Apply can be called again (e.g. after the config file has changed). Apply
+// returns the sources of the values of all settings which are set, keyed by setting key.
+func Apply(f File, flagValues map[string]string) (map[string]Source, error) {
+	initialEnvOnce.Do(func() {
+		initialEnv = make(map[string]string)
+		for _, s := range Settings {
+			if value, ok := os.LookupEnv(s.EnvVar); ok {
+				initialEnv[s.EnvVar] = value
+			}
+		}
+	})
+
+	values := make(map[string]string)
+	sources := make(map[string]Source)
+	for _, s := range Settings {
+		value, ok := flagValues[s.Key]
+		source := SourceFlag
+		if !ok {
+			value, ok = initialEnv[s.EnvVar]
+			source = SourceEnv
+		}
+		if !ok {
+			value, ok = f.Values[s.Key]
+			source = SourceFile
+		}
+		if ok {
+			values[s.Key] = value
+			sources[s.Key] = source
+		}
+	}
+	return sources, Restore(values)
+}
+
+// Effective returns the values of all settings which are set (i.e. after [Apply]), keyed by
+// setting key.
+func Effective() map[string]string {
+	values := make(map[string]string)
+	for _, s := range Settings {
+		if value, ok := os.LookupEnv(s.EnvVar); ok {
+			values[s.Key] = value
+		}
+	}
+	return values
+}
+
+// Restore sets the environment variables of all settings to the values (e.g. values previously
+// returned by [Effective], to undo an [Apply] which resulted in an invalid config), unsetting the
+// environment variables of settings without values.
+func Restore(values map[string]string) error {
+	for _, s := range Settings {
+		value, ok := values[s.Key]
+		if !ok {
+			if err := os.Unsetenv(s.EnvVar); err != nil {
+				return errors.Wrapf(err, "couldn't unset environment variable %s", s.EnvVar)
+			}
+			continue
+		}
+		if err := os.Setenv(s.EnvVar, value); err != nil {
+			return errors.Wrapf(err, "couldn't set environment variable %s", s.EnvVar)
+		}
+	}
+	return nil
+}
+
+// A Change is a change to the value of a setting.
+type Change struct {
+	Setting Setting
+	// Previous is the previous value, or nil if the setting was unset.
+	Previous *string
+	// Current is the current value, or nil if the setting is unset.
+	Current *string
+}
+
+func (c Change) String() string {
+	describe := func(value *string) string {
+		if value == nil {
+			return "unset"
+		}
+		return strconv.Quote(*value)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Setting.Key, describe(c.Previous), describe(c.Current))
+}
+
+// Diff returns the changes between two sets of values returned by [Effective].
+func Diff(previous, current map[string]string) []Change {
+	var changes []Change
+	for _, s := range Settings {
+		p, pok := previous[s.Key]
+		c, cok := current[s.Key]
+		if pok == cok && p == c {
+			continue
+		}
+		change := Change{Setting: s}
+		if pok {
+			change.Previous = &p
+		}
+		if cok {
+			change.Current = &c
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// WriteEffective writes the effective values of all settings (i.e. after [Apply]) as a TOML config
+// file, with a comment after each value with its source (from the sources returned by [Apply]).
+// Settings which aren't set are written with their default values.
+func WriteEffective(w io.Writer, sources map[string]Source) error {
+	var b bytes.Buffer
+	section := ""
+	for _, s := range Settings {
+		if s.Section() != section {
+			if section != "" {
+				b.WriteString("\n")
+			}
+			section = s.Section()
+			fmt.Fprintf(&b, "[%s]\n", section)
+		}
+		raw, ok := os.LookupEnv(s.EnvVar)
+		source := sources[s.Key]
+		if !ok {
+			raw = s.DefaultValue()
+			source = SourceDefault
+		}
+		value, err := s.Parse(raw)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value from %s", source)
+		}
+		line, err := toml.Marshal(map[string]any{s.Name(): value})
+		if err != nil {
+			return errors.Wrapf(err, "couldn't serialize %s", s.Key)
+		}
+		fmt.Fprintf(&b, "%s # %s\n", bytes.TrimRight(line, "\n"), source)
+	}
+	_, err := io.WriteString(w, strings.TrimRight(b.String(), "\n")+"\n")
+	return err
+}
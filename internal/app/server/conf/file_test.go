@@ -0,0 +1,47 @@
+package conf
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteEffective(t *testing.T) {
+	for _, s := range Settings {
+		t.Setenv(s.EnvVar, "")
+		if err := os.Unsetenv(s.EnvVar); err != nil {
+			t.Fatalf("couldn't unset environment variable %s: %s", s.EnvVar, err)
+		}
+	}
+	t.Setenv("HTTPS_PORT", "4443")
+
+	sources, err := Apply(
+		File{Values: map[string]string{"http.port": "4000", "https.port": "5443"}},
+		map[string]string{"log.level": "debug"},
+	)
+	if err != nil {
+		t.Fatalf("couldn't apply config: %s", err)
+	}
+	var b bytes.Buffer
+	if err = WriteEffective(&b, sources); err != nil {
+		t.Fatalf("couldn't write effective config: %s", err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	for _, expected := range []string{
+		`level = "debug" # flag`,
+		`port = 4443 # env`,
+		`port = 4000 # file`,
+		// Settings without values from the config file, environment variables, or flags
+		`format = "json" # default`,
+		`interval = "10s" # default`,
+		`numcounters = 3000000 # default`,
+		`cache_cost = 1.0 # default`,
+		`enabled = false # default`,
+	} {
+		if !slices.Contains(lines, expected) {
+			t.Errorf("effective config has no line %s:\n%s", expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package conf
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const httpEnvPrefix = "HTTP_"
+
+// Default values of HTTP settings, which are also shown in the help for command-line flags.
+const (
+	DefaultHTTPPort            = 3001
+	DefaultHTTPBasePath        = "/"
+	DefaultHTTPGzipLevel       = 1
+	DefaultHTTPShutdownTimeout = 5 * time.Second
+)
+
+type HTTPConfig struct {
+	Port int
+	// BasePath is the path prefix which all routes are served under, without a trailing slash; it's
+	// empty if routes are served from the root path.
+	BasePath  string
+	GzipLevel int
+	// TrustedProxies are the address ranges of reverse-proxies whose X-Forwarded-For,
+	// X-Forwarded-Host, X-Forwarded-Proto, and Forwarded headers are trusted. Those headers are
+	// ignored in requests from any other address, since they can be spoofed.
+	TrustedProxies []netip.Prefix
+	// ShutdownTimeout is the timeout for graceful shutdown before the server is forcibly shut down.
+	ShutdownTimeout time.Duration
+	// DevMode is whether error pages include the messages of internal errors, which may reveal
+	// details about the server.
+	DevMode bool
+}
+
+func getHTTPConfig() (c HTTPConfig, err error) {
+	rawPort, err := env.GetInt64(httpEnvPrefix+"PORT", DefaultHTTPPort)
+	if err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make port config")
+	}
+	c.Port = int(rawPort)
+
+	rawBasePath := env.GetString(httpEnvPrefix+"BASEPATH", DefaultHTTPBasePath)
+	if c.BasePath, err = ParseBasePath(rawBasePath); err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make base path config")
+	}
+
+	rawGzipLevel, err := env.GetInt64(httpEnvPrefix+"GZIPLEVEL", DefaultHTTPGzipLevel)
+	if err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make gzip level config")
+	}
+	c.GzipLevel = int(rawGzipLevel)
+
+	if c.TrustedProxies, err = ParseTrustedProxies(strings.FieldsFunc(
+		env.GetString(httpEnvPrefix+"TRUSTEDPROXIES", ""),
+		func(r rune) bool { return r == ',' || r == ' ' },
+	)); err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make trusted proxies config")
+	}
+
+	// This environment variable predates the HTTP_ prefix
+	rawShutdownTimeout := env.GetString("SHUTDOWNTIMEOUT", DefaultHTTPShutdownTimeout.String())
+	if c.ShutdownTimeout, err = time.ParseDuration(rawShutdownTimeout); err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make shutdown timeout config")
+	}
+
+	if c.DevMode, err = env.GetBool(httpEnvPrefix + "DEVMODE"); err != nil {
+		return HTTPConfig{}, errors.Wrap(err, "couldn't make dev mode config")
+	}
+	return c, nil
+}
+
+// ParseBasePath normalizes a base path for HTTP routes (e.g. portal, /portal, or /portal/) into the
+// form used by [HTTPConfig] (e.g. /portal).
+func ParseBasePath(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't parse base path %s", raw)
+	}
+	if u.Scheme != "" || u.Host != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.Errorf("base path %s must only be a path", raw)
+	}
+	basePath := path.Clean("/" + u.Path)
+	if basePath == "/" {
+		return "", nil
+	}
+	return basePath, nil
+}
+
+// TrustsProxy checks whether the remote address (e.g. from an HTTP request's RemoteAddr field) of
+// a request is in the address range of a trusted reverse-proxy.
+func (c HTTPConfig) TrustsProxy(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range c.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedProxyRanges returns the address ranges of trusted reverse-proxies in the form used by the
+// standard library and Echo.
+func (c HTTPConfig) TrustedProxyRanges() []*net.IPNet {
+	ranges := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, prefix := range c.TrustedProxies {
+		ranges = append(ranges, &net.IPNet{
+			IP:   prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+		})
+	}
+	return ranges
+}
+
+// ParseTrustedProxies parses the address ranges of trusted reverse-proxies, which may be CIDR
+// prefixes (e.g. 172.16.0.0/12) or single addresses (e.g. 127.0.0.1).
+func ParseTrustedProxies(raw []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(raw))
+	for _, rawPrefix := range raw {
+		if rawPrefix = strings.TrimSpace(rawPrefix); rawPrefix == "" {
+			continue
+		}
+		if !strings.Contains(rawPrefix, "/") {
+			addr, err := netip.ParseAddr(rawPrefix)
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't parse trusted proxy address %s", rawPrefix)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(rawPrefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse trusted proxy address range %s", rawPrefix)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const httpsEnvPrefix = "HTTPS_"
+
+// Default values of HTTPS settings, which are also shown in the help for command-line flags.
+const (
+	DefaultHTTPSPort = 3443
+)
+
+const defaultHSTSMaxAge = "0s"
+
+// HTTPSConfig configures the HTTPS server, which is only run if a TLS mode is configured for the
+// certificates client.
+type HTTPSConfig struct {
+	Port int
+	// Redirect is whether the HTTP server should redirect all requests to the HTTPS server, rather
+	// than serving the device portal over HTTP too.
+	Redirect bool
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header sent in HTTPS responses; if
+	// it's zero, the header isn't sent.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+}
+
+func getHTTPSConfig() (c HTTPSConfig, err error) {
+	rawPort, err := env.GetInt64(httpsEnvPrefix+"PORT", DefaultHTTPSPort)
+	if err != nil {
+		return HTTPSConfig{}, errors.Wrap(err, "couldn't make port config")
+	}
+	c.Port = int(rawPort)
+
+	if c.Redirect, err = env.GetBool(httpsEnvPrefix + "REDIRECT"); err != nil {
+		return HTTPSConfig{}, errors.Wrap(err, "couldn't make redirect config")
+	}
+
+	rawHSTSMaxAge := env.GetString(httpsEnvPrefix+"HSTSMAXAGE", defaultHSTSMaxAge)
+	if c.HSTSMaxAge, err = time.ParseDuration(rawHSTSMaxAge); err != nil {
+		return HTTPSConfig{}, errors.Wrap(err, "couldn't make HSTS max-age config")
+	}
+	c.HSTSIncludeSubdomains, err = env.GetBool(httpsEnvPrefix + "HSTSINCLUDESUBDOMAINS")
+	if err != nil {
+		return HTTPSConfig{}, errors.Wrap(err, "couldn't make HSTS includeSubDomains config")
+	}
+	if c.HSTSPreload, err = env.GetBool(httpsEnvPrefix + "HSTSPRELOAD"); err != nil {
+		return HTTPSConfig{}, errors.Wrap(err, "couldn't make HSTS preload config")
+	}
+	return c, nil
+}
+
+// URLPort returns the port for URLs of the HTTPS server, which is empty if browsers would use it
+// by default. If forwarded is true, the HTTPS server is assumed to be accessed through a trusted
+// reverse-proxy on the default port.
+func (c HTTPSConfig) URLPort(forwarded bool) string {
+	const defaultPort = 443
+	if forwarded || c.Port == defaultPort {
+		return ""
+	}
+	return strconv.Itoa(c.Port)
+}
@@ -0,0 +1,29 @@
+package conf
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const metricsEnvPrefix = "METRICS_"
+
+// MetricsConfig configures the Prometheus metrics endpoint.
+type MetricsConfig struct {
+	Enabled bool
+	// Port is the port of a separate HTTP server for the metrics endpoint; if it's zero, the metrics
+	// endpoint is served by the main HTTP server under the base path.
+	Port int
+}
+
+func getMetricsConfig() (c MetricsConfig, err error) {
+	if c.Enabled, err = env.GetBool(metricsEnvPrefix + "ENABLED"); err != nil {
+		return MetricsConfig{}, errors.Wrap(err, "couldn't make enabled config")
+	}
+
+	rawPort, err := env.GetInt64(metricsEnvPrefix+"PORT", 0)
+	if err != nil {
+		return MetricsConfig{}, errors.Wrap(err, "couldn't make port config")
+	}
+	c.Port = int(rawPort)
+	return c, nil
+}
@@ -0,0 +1,93 @@
+package conf
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const rateLimitEnvPrefix = "RATELIMIT_"
+
+const (
+	defaultRateLimitEnabled     = "false"
+	defaultRateLimitPagesRate   = 5
+	defaultRateLimitPagesBurst  = 20
+	defaultRateLimitAssetsRate  = 50
+	defaultRateLimitAssetsBurst = 200
+	defaultRateLimitAPIRate     = 2
+	defaultRateLimitAPIBurst    = 10
+	defaultRateLimitExpiresIn   = "3m"
+)
+
+// RateLimitBudget is the token bucket of each client for one class of routes.
+type RateLimitBudget struct {
+	// Rate is the rate at which tokens are added to the bucket, in requests per second; if it's zero,
+	// requests aren't limited.
+	Rate float64
+	// Burst is the capacity of the bucket, i.e. the number of requests which are allowed at once.
+	Burst int
+}
+
+// RateLimitConfig configures the per-client rate limiting of requests, which keeps a misbehaving
+// client (e.g. a kiosk browser stuck in a reload loop) from starving the machine.
+type RateLimitConfig struct {
+	// Enabled is false by default, since clients can only be told apart behind a reverse-proxy if
+	// the reverse-proxy is trusted; otherwise, all clients would share the reverse-proxy's budget.
+	Enabled bool
+	// Pages is the budget for requests for pages and other dynamic content.
+	Pages RateLimitBudget
+	// Assets is the budget for requests for static assets (scripts, stylesheets, fonts, images),
+	// which browsers make many of at once.
+	Assets RateLimitBudget
+	// API is the budget for requests to the JSON API and for requests which aren't GET or HEAD
+	// requests.
+	API RateLimitBudget
+	// ExpiresIn is how long the bucket of a client is kept after its last request.
+	ExpiresIn time.Duration
+}
+
+func getRateLimitBudget(name string, defaults RateLimitBudget) (b RateLimitBudget, err error) {
+	rawRate, err := env.GetFloat32(rateLimitEnvPrefix+name+"_RATE", float32(defaults.Rate))
+	if err != nil {
+		return RateLimitBudget{}, errors.Wrap(err, "couldn't make rate config")
+	}
+	b.Rate = float64(rawRate)
+
+	rawBurst, err := env.GetInt64(rateLimitEnvPrefix+name+"_BURST", int64(defaults.Burst))
+	if err != nil {
+		return RateLimitBudget{}, errors.Wrap(err, "couldn't make burst config")
+	}
+	b.Burst = int(rawBurst)
+	return b, nil
+}
+
+func getRateLimitConfig() (c RateLimitConfig, err error) {
+	rawEnabled := env.GetString(rateLimitEnvPrefix+"ENABLED", defaultRateLimitEnabled)
+	if c.Enabled, err = strconv.ParseBool(rawEnabled); err != nil {
+		return RateLimitConfig{}, errors.Wrapf(err, "couldn't parse enabled config %s", rawEnabled)
+	}
+
+	if c.Pages, err = getRateLimitBudget("PAGES", RateLimitBudget{
+		Rate: defaultRateLimitPagesRate, Burst: defaultRateLimitPagesBurst,
+	}); err != nil {
+		return RateLimitConfig{}, errors.Wrap(err, "couldn't make pages budget config")
+	}
+	if c.Assets, err = getRateLimitBudget("ASSETS", RateLimitBudget{
+		Rate: defaultRateLimitAssetsRate, Burst: defaultRateLimitAssetsBurst,
+	}); err != nil {
+		return RateLimitConfig{}, errors.Wrap(err, "couldn't make assets budget config")
+	}
+	if c.API, err = getRateLimitBudget("API", RateLimitBudget{
+		Rate: defaultRateLimitAPIRate, Burst: defaultRateLimitAPIBurst,
+	}); err != nil {
+		return RateLimitConfig{}, errors.Wrap(err, "couldn't make api budget config")
+	}
+
+	rawExpiresIn := env.GetString(rateLimitEnvPrefix+"EXPIRESIN", defaultRateLimitExpiresIn)
+	if c.ExpiresIn, err = time.ParseDuration(rawExpiresIn); err != nil {
+		return RateLimitConfig{}, errors.Wrap(err, "couldn't make expiration config")
+	}
+	return c, nil
+}
@@ -0,0 +1,394 @@
+package conf
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/certs"
+	"github.com/openUC2/device-portal/internal/clients/health"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+	"github.com/openUC2/device-portal/internal/clients/mdns"
+	"github.com/openUC2/device-portal/internal/clients/templates"
+)
+
+// A Kind is the kind of value which a setting takes.
+type Kind string
+
+const (
+	KindString   Kind = "string"
+	KindInt      Kind = "integer"
+	KindFloat    Kind = "number"
+	KindBool     Kind = "boolean"
+	KindDuration Kind = "duration"
+	// KindList is a list of strings, which is represented in environment variables as a
+	// comma-separated list.
+	KindList Kind = "list"
+)
+
+// describe describes the kind for error messages.
+func (k Kind) describe() string {
+	switch k {
+	default:
+		return "a " + string(k)
+	case KindInt:
+		return "an integer"
+	case KindDuration:
+		return "a duration (e.g. 5s)"
+	case KindList:
+		return "a list of strings"
+	}
+}
+
+// A Setting is a configuration setting which can be set in the config file, by an environment
+// variable, or (for some settings) by a command-line flag.
+type Setting struct {
+	// Key is the key of the setting in the config file, in the form section.name.
+	Key string
+	// EnvVar is the environment variable which sets the setting.
+	EnvVar string
+	// Flag is the name of the command-line flag which sets the setting, if there is one.
+	Flag string
+	// Kind is the kind of value which the setting takes.
+	Kind Kind
+	// Values are the allowed values of the setting, if it only allows specific values.
+	Values []string
+	// Default is the value (in the form used in the setting's environment variable) which is used
+	// if the setting isn't set.
+	Default string
+	// defaultFunc, if it's set, determines the default value instead of Default, for settings whose
+	// default values depend on the machine or on other settings.
+	defaultFunc func() string
+	// Reloadable is whether changes to the setting take effect when the config is reloaded, rather
+	// than only after a restart.
+	Reloadable bool
+}
+
+// Settings are all settings of the device portal, in the order in which they're documented.
+var Settings = []Setting{
+	{
+		Key: "log.level", EnvVar: "LOG_LEVEL", Flag: "log-level", Kind: KindString,
+		Values: []string{"debug", "info", "warn", "error"}, Default: logging.DefaultLevel,
+		Reloadable: true,
+	},
+	{
+		Key: "log.format", EnvVar: "LOG_FORMAT", Flag: "log-format", Kind: KindString,
+		Values: []string{"text", "json", "logfmt"}, Default: string(logging.DefaultFormat),
+	},
+
+	{
+		Key: "http.port", EnvVar: "HTTP_PORT", Flag: "http-port", Kind: KindInt,
+		Default: formatInt(DefaultHTTPPort),
+	},
+	{
+		Key: "http.basepath", EnvVar: "HTTP_BASEPATH", Flag: "http-base-path", Kind: KindString,
+		Default: DefaultHTTPBasePath,
+	},
+	{
+		Key: "http.gziplevel", EnvVar: "HTTP_GZIPLEVEL", Flag: "http-gzip-level", Kind: KindInt,
+		Default: formatInt(DefaultHTTPGzipLevel),
+	},
+	{
+		Key: "http.trustedproxies", EnvVar: "HTTP_TRUSTEDPROXIES", Flag: "http-trusted-proxies",
+		Kind: KindList,
+	},
+	{
+		Key: "http.shutdowntimeout", EnvVar: "SHUTDOWNTIMEOUT", Flag: "http-shutdown-timeout",
+		Kind: KindDuration, Default: DefaultHTTPShutdownTimeout.String(),
+	},
+	{Key: "http.devmode", EnvVar: "HTTP_DEVMODE", Kind: KindBool, Default: "false"},
+
+	{
+		Key: "https.port", EnvVar: "HTTPS_PORT", Flag: "https-port", Kind: KindInt,
+		Default: formatInt(DefaultHTTPSPort),
+	},
+	{
+		Key: "https.redirect", EnvVar: "HTTPS_REDIRECT", Flag: "https-redirect", Kind: KindBool,
+		Default: "false",
+	},
+	{
+		Key: "https.hstsmaxage", EnvVar: "HTTPS_HSTSMAXAGE", Kind: KindDuration,
+		Default: defaultHSTSMaxAge,
+	},
+	{
+		Key: "https.hstsincludesubdomains", EnvVar: "HTTPS_HSTSINCLUDESUBDOMAINS", Kind: KindBool,
+		Default: "false",
+	},
+	{Key: "https.hstspreload", EnvVar: "HTTPS_HSTSPRELOAD", Kind: KindBool, Default: "false"},
+
+	{
+		Key: "tls.mode", EnvVar: "TLS_MODE", Flag: "tls-mode", Kind: KindString,
+		Values: []string{"none", "file", "self-signed", "local-ca"}, Default: string(certs.DefaultMode),
+	},
+	{Key: "tls.certfile", EnvVar: "TLS_CERTFILE", Kind: KindString, Reloadable: true},
+	{Key: "tls.keyfile", EnvVar: "TLS_KEYFILE", Kind: KindString, Reloadable: true},
+	{
+		Key: "tls.dir", EnvVar: "TLS_DIR", Kind: KindString, Default: certs.DefaultDir,
+		Reloadable: true,
+	},
+
+	// The environment variable's duplicated prefix is a historical accident
+	{
+		Key: "cache.numcounters", EnvVar: "CACHE_CACHE_NUMCOUNTERS", Kind: KindInt,
+		Default: formatInt(defaultNumCounters),
+	},
+	{
+		Key: "cache.maxcost", EnvVar: "CACHE_MAXCOST", Kind: KindInt,
+		Default: formatInt(defaultMaxCost),
+	},
+	{
+		Key: "cache.bufferitems", EnvVar: "CACHE_BUFFERITEMS", Kind: KindInt,
+		Default: formatInt(defaultBufferItems),
+	},
+	{Key: "cache.metrics", EnvVar: "CACHE_METRICS", Kind: KindBool, Default: "false"},
+
+	{Key: "metrics.enabled", EnvVar: "METRICS_ENABLED", Kind: KindBool, Default: "false"},
+	{Key: "metrics.port", EnvVar: "METRICS_PORT", Kind: KindInt, Default: "0"},
+
+	{
+		Key: "ratelimit.enabled", EnvVar: "RATELIMIT_ENABLED", Kind: KindBool,
+		Default: defaultRateLimitEnabled,
+	},
+	{
+		Key: "ratelimit.pages_rate", EnvVar: "RATELIMIT_PAGES_RATE", Kind: KindFloat,
+		Default: formatFloat(defaultRateLimitPagesRate),
+	},
+	{
+		Key: "ratelimit.pages_burst", EnvVar: "RATELIMIT_PAGES_BURST", Kind: KindInt,
+		Default: formatInt(defaultRateLimitPagesBurst),
+	},
+	{
+		Key: "ratelimit.assets_rate", EnvVar: "RATELIMIT_ASSETS_RATE", Kind: KindFloat,
+		Default: formatFloat(defaultRateLimitAssetsRate),
+	},
+	{
+		Key: "ratelimit.assets_burst", EnvVar: "RATELIMIT_ASSETS_BURST", Kind: KindInt,
+		Default: formatInt(defaultRateLimitAssetsBurst),
+	},
+	{
+		Key: "ratelimit.api_rate", EnvVar: "RATELIMIT_API_RATE", Kind: KindFloat,
+		Default: formatFloat(defaultRateLimitAPIRate),
+	},
+	{
+		Key: "ratelimit.api_burst", EnvVar: "RATELIMIT_API_BURST", Kind: KindInt,
+		Default: formatInt(defaultRateLimitAPIBurst),
+	},
+	{
+		Key: "ratelimit.expiresin", EnvVar: "RATELIMIT_EXPIRESIN", Kind: KindDuration,
+		Default: defaultRateLimitExpiresIn,
+	},
+
+	// Without a name, the name is read from the name file
+	{Key: "machinename.name", EnvVar: "MACHINENAME_NAME", Kind: KindString, Reloadable: true},
+	{
+		Key: "machinename.namefile", EnvVar: "MACHINENAME_NAMEFILE", Kind: KindString,
+		Default: machinename.DefaultNameFile, Reloadable: true,
+	},
+	{
+		Key: "machinename.cache_cost", EnvVar: "MACHINENAME_CACHE_COST", Kind: KindFloat,
+		Default: formatFloat(machinename.DefaultCacheCost), Reloadable: true,
+	},
+
+	{
+		Key: "templates.path", EnvVar: "TEMPLATES_PATH", Kind: KindString,
+		Default: templates.DefaultPath, Reloadable: true,
+	},
+	{
+		Key: "templates.watch", EnvVar: "TEMPLATES_WATCH", Kind: KindString,
+		Values: []string{"notify", "poll", "none"}, Default: string(templates.DefaultWatchMode),
+	},
+	{
+		Key: "templates.pollinterval", EnvVar: "TEMPLATES_POLLINTERVAL", Kind: KindDuration,
+		Default: templates.DefaultPollInterval,
+	},
+
+	{Key: "branding.staticpath", EnvVar: "BRANDING_STATICPATH", Kind: KindString},
+	{
+		Key: "branding.name", EnvVar: "BRANDING_NAME", Kind: KindString,
+		Default: DefaultBrandingName,
+	},
+	{
+		Key: "branding.shortname", EnvVar: "BRANDING_SHORTNAME", Kind: KindString,
+		defaultFunc: func() string {
+			return env.GetString(brandingEnvPrefix+"NAME", DefaultBrandingName)
+		},
+	},
+	{
+		Key: "branding.themecolor", EnvVar: "BRANDING_THEMECOLOR", Kind: KindString,
+		Default: DefaultBrandingThemeColor,
+	},
+	{
+		Key: "branding.backgroundcolor", EnvVar: "BRANDING_BACKGROUNDCOLOR", Kind: KindString,
+		Default: DefaultBrandingBackgroundColor,
+	},
+
+	{Key: "apps.path", EnvVar: "APPS_PATH", Kind: KindString, Default: apps.DefaultPath},
+	{
+		Key: "apps.watch", EnvVar: "APPS_WATCH", Kind: KindString,
+		Values: []string{"notify", "poll", "none"}, Default: string(apps.DefaultWatchMode),
+	},
+	{
+		Key: "apps.pollinterval", EnvVar: "APPS_POLLINTERVAL", Kind: KindDuration,
+		Default: apps.DefaultPollInterval,
+	},
+	{
+		Key: "apps.cache_cost", EnvVar: "APPS_CACHE_COST", Kind: KindFloat,
+		Default: formatFloat(apps.DefaultCacheCost),
+	},
+
+	{
+		Key: "health.interval", EnvVar: "HEALTH_INTERVAL", Kind: KindDuration,
+		Default: health.DefaultInterval,
+	},
+	{
+		Key: "health.timeout", EnvVar: "HEALTH_TIMEOUT", Kind: KindDuration,
+		Default: health.DefaultTimeout,
+	},
+	{
+		Key: "health.startupgrace", EnvVar: "HEALTH_STARTUPGRACE", Kind: KindDuration,
+		Default: health.DefaultStartupGrace,
+	},
+	{
+		Key: "health.degradedlatency", EnvVar: "HEALTH_DEGRADEDLATENCY", Kind: KindDuration,
+		Default: health.DefaultDegradedLatency,
+	},
+	{
+		Key: "health.cache_cost", EnvVar: "HEALTH_CACHE_COST", Kind: KindFloat,
+		Default: formatFloat(health.DefaultCacheCost),
+	},
+
+	{Key: "mdns.enabled", EnvVar: "MDNS_ENABLED", Kind: KindBool, Default: mdns.DefaultEnabled},
+	{
+		Key: "mdns.hostname", EnvVar: "MDNS_HOSTNAME", Kind: KindString,
+		defaultFunc: func() string {
+			hostname, _ := os.Hostname()
+			return hostname
+		},
+	},
+	{Key: "mdns.interfaces", EnvVar: "MDNS_INTERFACES", Kind: KindList},
+	{Key: "mdns.port", EnvVar: "MDNS_PORT", Kind: KindInt, Default: "0"},
+	{
+		Key: "mdns.browseinterval", EnvVar: "MDNS_BROWSEINTERVAL", Kind: KindDuration,
+		Default: mdns.DefaultBrowseInterval,
+	},
+	{
+		Key: "mdns.cache_cost", EnvVar: "MDNS_CACHE_COST", Kind: KindFloat,
+		Default: formatFloat(mdns.DefaultCacheCost),
+	},
+}
+
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// LookupSetting returns the setting with the specified key.
+func LookupSetting(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Section returns the section of the config file which the setting is in.
+func (s Setting) Section() string {
+	section, _, _ := strings.Cut(s.Key, ".")
+	return section
+}
+
+// Name returns the name of the setting within its section of the config file.
+func (s Setting) Name() string {
+	_, name, _ := strings.Cut(s.Key, ".")
+	return name
+}
+
+// DefaultValue returns the value (in the form used in the setting's environment variable) which is
+// used if the setting isn't set.
+func (s Setting) DefaultValue() string {
+	if s.defaultFunc != nil {
+		return s.defaultFunc()
+	}
+	return s.Default
+}
+
+// FromFile converts a value decoded from a TOML or YAML config file into the form used in the
+// setting's environment variable, checking that the value is of the setting's kind.
+func (s Setting) FromFile(value any) (string, error) {
+	var raw string
+	switch v := value.(type) {
+	default:
+		return "", errors.Errorf("%s must be %s, but it's %v", s.Key, s.Kind.describe(), value)
+	case string:
+		raw = v
+	case bool:
+		raw = strconv.FormatBool(v)
+	case int:
+		raw = strconv.Itoa(v)
+	case int64:
+		raw = strconv.FormatInt(v, 10)
+	case uint64:
+		raw = strconv.FormatUint(v, 10)
+	case float64:
+		raw = strconv.FormatFloat(v, 'g', -1, 64)
+	case []any:
+		if s.Kind != KindList {
+			return "", errors.Errorf("%s must be %s, but it's a list", s.Key, s.Kind.describe())
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			rawItem, ok := item.(string)
+			if !ok {
+				return "", errors.Errorf("%s must be a list of strings, but it has %v", s.Key, item)
+			}
+			items = append(items, rawItem)
+		}
+		raw = strings.Join(items, ",")
+	}
+	if _, err := s.Parse(raw); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Parse parses the value of the setting from the form used in the setting's environment variable
+// into a string, int64, float64, bool, or []string, checking that the value is valid.
+func (s Setting) Parse(raw string) (value any, err error) {
+	switch s.Kind {
+	default:
+		value = raw
+	case KindInt:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case KindFloat:
+		value, err = strconv.ParseFloat(raw, 64)
+	case KindBool:
+		value, err = strconv.ParseBool(raw)
+	case KindDuration:
+		_, err = time.ParseDuration(raw)
+		value = raw
+	case KindList:
+		value = strings.FieldsFunc(raw, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	if err != nil {
+		return nil, errors.Errorf("%s must be %s, but it's %s", s.Key, s.Kind.describe(), raw)
+	}
+	if len(s.Values) > 0 && !slices.Contains(s.Values, raw) {
+		return nil, errors.Errorf(
+			"%s must be one of: %s, but it's %s", s.Key, strings.Join(s.Values, ", "), raw,
+		)
+	}
+	return value, nil
+}
@@ -1,51 +1,247 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"html"
 	"io/fs"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest"
 	"github.com/sargassum-world/godest/httperr"
+
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/app/server/routes/api"
 )
 
 type ErrorData struct {
 	Code     int
 	Error    httperr.DescriptiveError
 	Messages []string
+	// RequestID identifies the request in the server logs, so that users can cite it when they
+	// report the error.
+	RequestID string
+	// Template describes the template which caused the error, if the error was a problem with a
+	// template.
+	Template *TemplateErrorData
+}
+
+// Problem is an RFC 9457 problem details object, which is sent instead of an error page to clients
+// which prefer JSON.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// The following fields are extensions of the standard members:
+
+	RequestID string   `json:"requestId,omitempty"`
+	Messages  []string `json:"messages,omitempty"`
 }
 
-func NewHTTPErrorHandler(tr godest.TemplateRenderer, templatesFS fs.FS) echo.HTTPErrorHandler {
+const problemJSONContentType = "application/problem+json"
+
+// hiddenTemplateDescription replaces the descriptions of template problems on the fallback error
+// page outside dev mode.
+const hiddenTemplateDescription = "(details are only shown in dev mode; please check the server " +
+	"logs)"
+
+// Placeholders in the fallback error page, which isn't rendered as a template.
+const (
+	fallbackBasePathPlaceholder            = "{{.BasePath}}"
+	fallbackRequestIDPlaceholder           = "{{.RequestID}}"
+	fallbackTemplateNamePlaceholder        = "{{.TemplateName}}"
+	fallbackTemplateLinePlaceholder        = "{{.TemplateLine}}"
+	fallbackTemplateDescriptionPlaceholder = "{{.TemplateDescription}}"
+)
+
+// NewHTTPErrorHandler makes an error handler which responds with an error page, or with a problem
+// details object for API requests and for clients which prefer JSON. In dev mode, the messages of
+// internal errors are included in responses.
+func NewHTTPErrorHandler(
+	tr godest.TemplateRenderer, templatesFS fs.FS, config conf.HTTPConfig,
+) echo.HTTPErrorHandler {
 	tr.MustHave("app/httperr.page.tmpl")
 	return func(err error, c echo.Context) {
 		c.Logger().Error(err)
-
-		// Process error code
-		code := http.StatusInternalServerError
-		if herr, ok := err.(*echo.HTTPError); ok {
-			code = herr.Code
+		if c.Response().Committed {
+			// We can't replace a response which was already (partially) sent
+			return
 		}
-		errorData := ErrorData{
-			Code:  code,
-			Error: httperr.Describe(code),
+
+		errorData := describeError(err, c, config.DevMode)
+		if prefersJSON(c.Request(), config.BasePath+api.URLPrefix) {
+			if perr := sendProblem(c, errorData); perr != nil {
+				c.Logger().Error(errors.Wrap(perr, "couldn't send problem details in error handler"))
+			}
+			return
 		}
 
 		// Produce output
 		perr := tr.Page(
-			c.Response(), c.Request(), code, "app/httperr.page.tmpl", errorData, struct{}{},
+			c.Response(), c.Request(), errorData.Code, "app/httperr.page.tmpl", errorData, struct{}{},
 			godest.WithUncacheable(),
 		)
 		if perr != nil {
 			c.Logger().Error(errors.Wrap(perr, "couldn't render templated error page in error handler"))
-			fallbackErrorPage, ferr := fs.ReadFile(templatesFS, "app/httperr.html")
-			if ferr != nil {
-				c.Logger().Error(errors.Wrap(perr, "couldn't load fallback error page in error handler"))
+			if perr = sendFallbackErrorPage(
+				c, templatesFS, errorData, perr, config,
+			); perr != nil {
+				c.Logger().Error(perr)
 			}
-			perr = c.HTML(http.StatusInternalServerError, string(fallbackErrorPage))
-			if perr != nil {
-				c.Logger().Error(errors.Wrap(perr, "couldn't send fallback error page in error handler"))
+		}
+	}
+}
+
+// describeError determines the status code and the messages of the error page for the error.
+func describeError(err error, c echo.Context, devMode bool) ErrorData {
+	code := http.StatusInternalServerError
+	var herr *echo.HTTPError
+	isHTTPError := errors.As(err, &herr)
+	if isHTTPError {
+		code = herr.Code
+	}
+	errorData := ErrorData{
+		Code:      code,
+		Error:     httperr.Describe(code),
+		RequestID: logging.RequestID(c),
+	}
+
+	// Messages of HTTP errors are meant for users, unless they're just the status text
+	if isHTTPError {
+		if message, ok := herr.Message.(string); ok && message != http.StatusText(code) {
+			errorData.Messages = append(errorData.Messages, message)
+		}
+	}
+	if retryAfter := c.Response().Header().Get("Retry-After"); retryAfter != "" {
+		errorData.Messages = append(errorData.Messages, fmt.Sprintf(
+			"Too many requests were sent from your device. Please wait %s seconds before trying again.",
+			retryAfter,
+		))
+	}
+	// Messages of other errors may reveal internal details, so they're only shown in dev mode
+	if devMode {
+		switch {
+		case !isHTTPError:
+			errorData.Messages = append(errorData.Messages, err.Error())
+		case herr.Internal != nil:
+			errorData.Messages = append(errorData.Messages, herr.Internal.Error())
+		}
+	}
+
+	// Only the template's name and line are shown outside dev mode, since the description may include
+	// the messages of errors returned by template functions
+	if template, ok := describeTemplateError(err); ok {
+		if !devMode {
+			template.Description = ""
+		}
+		errorData.Template = &template
+	}
+	return errorData
+}
+
+// prefersJSON checks whether the client should receive a problem details object rather than an
+// error page, which is the case for API requests and for requests whose Accept header gives a JSON
+// media type a higher quality value than any HTML media type (or the same quality value, if the
+// JSON media type is listed first).
+func prefersJSON(r *http.Request, apiPrefix string) bool {
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		return true
+	}
+	html := acceptedMediaRange{quality: -1}
+	json := acceptedMediaRange{quality: -1}
+	for i, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if rawQuality, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(rawQuality, 64); err != nil {
+				continue
 			}
 		}
+		switch {
+		case mediaType == "text/html", mediaType == "application/xhtml+xml":
+			html = html.best(acceptedMediaRange{quality: quality, position: i})
+		case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+			json = json.best(acceptedMediaRange{quality: quality, position: i})
+		}
+	}
+	if json.quality <= 0 {
+		return false // a quality value of 0 means that JSON isn't acceptable
+	}
+	return json.quality > html.quality ||
+		(json.quality == html.quality && json.position < html.position)
+}
+
+// acceptedMediaRange is the quality value and position of a media range in an Accept header.
+type acceptedMediaRange struct {
+	quality  float64
+	position int
+}
+
+// best returns whichever media range has the higher quality value, or the earlier one if their
+// quality values are equal.
+func (a acceptedMediaRange) best(b acceptedMediaRange) acceptedMediaRange {
+	if b.quality > a.quality {
+		return b
+	}
+	return a
+}
+
+func sendProblem(c echo.Context, errorData ErrorData) error {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(errorData.Code),
+		Status:    errorData.Code,
+		Detail:    errorData.Error.Description,
+		Instance:  c.Request().URL.Path,
+		RequestID: errorData.RequestID,
+		Messages:  errorData.Messages,
+	}
+	c.Response().Header().Set(echo.HeaderContentType, problemJSONContentType)
+	c.Response().WriteHeader(errorData.Code)
+	return errors.Wrap(json.NewEncoder(c.Response()).Encode(problem), "couldn't encode problem")
+}
+
+// sendFallbackErrorPage sends the static fallback error page, for when the templated error page
+// can't be rendered because of the rendering error perr. The description of perr is only included
+// in dev mode.
+func sendFallbackErrorPage(
+	c echo.Context, templatesFS fs.FS, errorData ErrorData, perr error, config conf.HTTPConfig,
+) error {
+	fallbackErrorPage, err := fs.ReadFile(templatesFS, "app/httperr.html")
+	if err != nil {
+		return errors.Wrap(err, "couldn't load fallback error page in error handler")
+	}
+	template, ok := describeTemplateError(perr)
+	if !ok {
+		template = TemplateErrorData{Name: "(unknown)", Description: perr.Error()}
+	}
+	if !config.DevMode {
+		template.Description = hiddenTemplateDescription
+	}
+	line := "(unknown)"
+	if template.Line > 0 {
+		line = strconv.Itoa(template.Line)
 	}
+	page := strings.NewReplacer(
+		fallbackBasePathPlaceholder, html.EscapeString(config.BasePath),
+		fallbackRequestIDPlaceholder, html.EscapeString(errorData.RequestID),
+		fallbackTemplateNamePlaceholder, html.EscapeString(template.Name),
+		fallbackTemplateLinePlaceholder, line,
+		fallbackTemplateDescriptionPlaceholder, html.EscapeString(template.Description),
+	).Replace(string(fallbackErrorPage))
+	return errors.Wrap(
+		c.HTML(http.StatusInternalServerError, page),
+		"couldn't send fallback error page in error handler",
+	)
 }
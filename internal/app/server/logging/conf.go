@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"log/slog"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const envPrefix = "LOG_"
+
+// Format determines how log records are written.
+type Format string
+
+const (
+	// FormatText writes each log record as a human-readable line.
+	FormatText Format = "text"
+	// FormatJSON writes each log record as a JSON object on its own line.
+	FormatJSON Format = "json"
+	// FormatLogfmt writes each log record as a line of key=value pairs.
+	FormatLogfmt Format = "logfmt"
+)
+
+// Default values of logging settings, which are also shown in the help for command-line flags.
+const (
+	DefaultLevel  = "info"
+	DefaultFormat = FormatJSON
+)
+
+type Config struct {
+	// Level is the minimum level of log records which are written.
+	Level  slog.Level
+	Format Format
+}
+
+func GetConfig() (c Config, err error) {
+	rawLevel := env.GetString(envPrefix+"LEVEL", DefaultLevel)
+	if err = c.Level.UnmarshalText([]byte(rawLevel)); err != nil {
+		return Config{}, errors.Wrapf(err, "couldn't parse level config %s", rawLevel)
+	}
+
+	c.Format = Format(env.GetString(envPrefix+"FORMAT", string(DefaultFormat)))
+	switch c.Format {
+	default:
+		return Config{}, errors.Errorf(
+			"unknown log format %s (must be one of: %s, %s, %s)",
+			c.Format, FormatText, FormatJSON, FormatLogfmt,
+		)
+	case FormatText, FormatJSON, FormatLogfmt:
+	}
+	return c, nil
+}
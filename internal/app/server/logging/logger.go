@@ -0,0 +1,229 @@
+// Package logging provides a structured, leveled logger which can be used as Echo's logger (and
+// thus as a godest.Logger), with log records written as human-readable text, JSON, or logfmt
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Logger adapts a slog.Logger to Echo's logger interface.
+type Logger struct {
+	Config Config
+
+	slog   *slog.Logger
+	level  *slog.LevelVar
+	output io.Writer
+	prefix string
+}
+
+func NewLogger(c Config, output io.Writer) *Logger {
+	l := &Logger{
+		Config: c,
+		level:  &slog.LevelVar{},
+	}
+	l.level.Set(c.Level)
+	l.SetOutput(output)
+	return l
+}
+
+// Slog returns the underlying slog.Logger.
+func (l *Logger) Slog() *slog.Logger {
+	return l.slog
+}
+
+// With returns a logger which adds the specified attributes (as in slog.Logger.With) to each log
+// record. The returned logger shares its level with l.
+func (l *Logger) With(args ...any) *Logger {
+	child := *l
+	child.slog = l.slog.With(args...)
+	return &child
+}
+
+// SetSlogLevel changes the minimum level of log records which are written by l and by all loggers
+// derived from it.
+func (l *Logger) SetSlogLevel(level slog.Level) {
+	l.level.Set(level)
+}
+
+func (l *Logger) newHandler(output io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{Level: l.level}
+	switch l.Config.Format {
+	default:
+		return slog.NewJSONHandler(output, options)
+	case FormatText:
+		return newTextHandler(output, options)
+	case FormatLogfmt:
+		return slog.NewTextHandler(output, options)
+	}
+}
+
+// Echo's logger interface
+
+func (l *Logger) Output() io.Writer {
+	return l.output
+}
+
+func (l *Logger) SetOutput(w io.Writer) {
+	l.output = w
+	l.slog = slog.New(l.newHandler(w))
+	if l.prefix != "" {
+		l.slog = l.slog.With("prefix", l.prefix)
+	}
+}
+
+func (l *Logger) Prefix() string {
+	return l.prefix
+}
+
+func (l *Logger) SetPrefix(p string) {
+	l.prefix = p
+	l.SetOutput(l.output)
+}
+
+// Level returns the minimum level of log records which are written, as an Echo log level.
+func (l *Logger) Level() log.Lvl {
+	switch level := l.level.Level(); {
+	case level <= slog.LevelDebug:
+		return log.DEBUG
+	case level <= slog.LevelInfo:
+		return log.INFO
+	case level <= slog.LevelWarn:
+		return log.WARN
+	case level <= slog.LevelError:
+		return log.ERROR
+	default:
+		return log.OFF
+	}
+}
+
+// SetLevel changes the minimum level of log records which are written, as an Echo log level.
+func (l *Logger) SetLevel(v log.Lvl) {
+	switch v {
+	case log.DEBUG:
+		l.level.Set(slog.LevelDebug)
+	case log.INFO:
+		l.level.Set(slog.LevelInfo)
+	case log.WARN:
+		l.level.Set(slog.LevelWarn)
+	case log.ERROR:
+		l.level.Set(slog.LevelError)
+	case log.OFF:
+		const levelOff = slog.LevelError + 4
+		l.level.Set(levelOff)
+	}
+}
+
+// SetHeader does nothing, since the format of log records is determined by the logger's config.
+func (l *Logger) SetHeader(string) {}
+
+func (l *Logger) log(level slog.Level, msg string) {
+	l.slog.Log(context.Background(), level, msg)
+}
+
+func (l *Logger) logj(level slog.Level, j log.JSON) {
+	args := make([]any, 0, len(j))
+	for _, key := range slices.Sorted(maps.Keys(j)) {
+		args = append(args, slog.Any(key, j[key]))
+	}
+	l.slog.Log(context.Background(), level, "", args...)
+}
+
+func (l *Logger) Print(i ...any) {
+	l.log(slog.LevelInfo, fmt.Sprint(i...))
+}
+
+func (l *Logger) Printf(format string, args ...any) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Printj(j log.JSON) {
+	l.logj(slog.LevelInfo, j)
+}
+
+func (l *Logger) Debug(i ...any) {
+	l.log(slog.LevelDebug, fmt.Sprint(i...))
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debugj(j log.JSON) {
+	l.logj(slog.LevelDebug, j)
+}
+
+func (l *Logger) Info(i ...any) {
+	l.log(slog.LevelInfo, fmt.Sprint(i...))
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.log(slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infoj(j log.JSON) {
+	l.logj(slog.LevelInfo, j)
+}
+
+func (l *Logger) Warn(i ...any) {
+	l.log(slog.LevelWarn, fmt.Sprint(i...))
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	l.log(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnj(j log.JSON) {
+	l.logj(slog.LevelWarn, j)
+}
+
+func (l *Logger) Error(i ...any) {
+	l.log(slog.LevelError, fmt.Sprint(i...))
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorj(j log.JSON) {
+	l.logj(slog.LevelError, j)
+}
+
+func (l *Logger) Fatal(i ...any) {
+	l.Error(i...)
+	os.Exit(1)
+}
+
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.Errorf(format, args...)
+	os.Exit(1)
+}
+
+func (l *Logger) Fatalj(j log.JSON) {
+	l.Errorj(j)
+	os.Exit(1)
+}
+
+func (l *Logger) Panic(i ...any) {
+	msg := fmt.Sprint(i...)
+	l.log(slog.LevelError, msg)
+	panic(msg)
+}
+
+func (l *Logger) Panicf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(slog.LevelError, msg)
+	panic(msg)
+}
+
+func (l *Logger) Panicj(j log.JSON) {
+	l.Errorj(j)
+	panic(j)
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"crypto/rand"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requestIDKey is the key of the request ID in the Echo context.
+const requestIDKey = "requestID"
+
+// RequestID returns the ID of the request, or an empty string if the request has no ID.
+func RequestID(c echo.Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// maxRequestIDLength is the maximum length of request IDs accepted from the X-Request-ID header,
+// which is enough for UUIDs and for the IDs generated by common reverse-proxies.
+const maxRequestIDLength = 64
+
+// validRequestID checks whether a request ID from the X-Request-ID header can be used, so that
+// clients can't inject arbitrary text into logs and error pages.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDs is middleware which identifies each request by the ID in its X-Request-ID header (e.g.
+// as set by a reverse-proxy), or by a random ID if it has no valid ID. The ID is sent in the
+// X-Request-ID response header, and the request's logger is replaced with one which adds the ID to
+// all log records.
+func RequestIDs(l *Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = rand.Text()
+			}
+			c.Set(requestIDKey, id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetLogger(l.With("request_id", id))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// textHandler is a slog.Handler which writes each log record as a human-readable line, starting
+// with the time, the level, and the message, followed by the attributes as key=value pairs.
+type textHandler struct {
+	options *slog.HandlerOptions
+	output  io.Writer
+	// mu is shared by all handlers derived from the same handler, since they share the output.
+	mu *sync.Mutex
+	// attrs are the preformatted attributes added with WithAttrs.
+	attrs []byte
+	// groupPrefix is the prefix of the keys of attributes, from the groups opened with WithGroup.
+	groupPrefix string
+}
+
+func newTextHandler(output io.Writer, options *slog.HandlerOptions) *textHandler {
+	return &textHandler{
+		options: options,
+		output:  output,
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.options.Level != nil {
+		minLevel = h.options.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := &bytes.Buffer{}
+	if !r.Time.IsZero() {
+		buf.WriteString(r.Time.Format(time.DateTime))
+		buf.WriteByte(' ')
+	}
+	const levelWidth = 5
+	level := r.Level.String()
+	buf.WriteString(level + strings.Repeat(" ", max(0, levelWidth-len(level))))
+	if r.Message != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(r.Message)
+	}
+	buf.Write(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(buf, h.groupPrefix, a)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.output.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	buf := bytes.NewBuffer(slices.Clone(h.attrs))
+	for _, a := range attrs {
+		appendAttr(buf, h.groupPrefix, a)
+	}
+	child.attrs = buf.Bytes()
+	return &child
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.groupPrefix = h.groupPrefix + name + "."
+	return &child
+}
+
+// appendAttr writes the attribute as a key=value pair preceded by a space, with keys of attributes
+// in groups prefixed by the names of the groups.
+func appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, groupAttr := range a.Value.Group() {
+			appendAttr(buf, prefix, groupAttr)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(prefix + a.Key)
+	buf.WriteByte('=')
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+		value = strconv.Quote(value)
+	}
+	buf.WriteString(value)
+}
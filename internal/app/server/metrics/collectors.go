@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"github.com/dgraph-io/ristretto"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/clients/health"
+)
+
+// Cache
+
+// cacheCollector exports the metrics of the ristretto client cache.
+type cacheCollector struct {
+	metrics  *ristretto.Metrics
+	counters []cacheCounter
+}
+
+type cacheCounter struct {
+	desc  *prometheus.Desc
+	value func(m *ristretto.Metrics) uint64
+}
+
+func newCacheCounter(name, help string, value func(m *ristretto.Metrics) uint64) cacheCounter {
+	return cacheCounter{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cache", name), help, nil, nil,
+		),
+		value: value,
+	}
+}
+
+func newCacheCollector(metrics *ristretto.Metrics) *cacheCollector {
+	return &cacheCollector{
+		metrics: metrics,
+		counters: []cacheCounter{
+			newCacheCounter(
+				"hits_total", "Number of cache lookups which found a key.", (*ristretto.Metrics).Hits,
+			),
+			newCacheCounter(
+				"misses_total", "Number of cache lookups which didn't find a key.",
+				(*ristretto.Metrics).Misses,
+			),
+			newCacheCounter(
+				"keys_added_total", "Number of keys added to the cache.",
+				(*ristretto.Metrics).KeysAdded,
+			),
+			newCacheCounter(
+				"keys_updated_total", "Number of cached keys whose values were updated.",
+				(*ristretto.Metrics).KeysUpdated,
+			),
+			newCacheCounter(
+				"keys_evicted_total", "Number of keys evicted from the cache.",
+				(*ristretto.Metrics).KeysEvicted,
+			),
+			newCacheCounter(
+				"cost_added_total", "Total cost of keys added to the cache.",
+				(*ristretto.Metrics).CostAdded,
+			),
+			newCacheCounter(
+				"cost_evicted_total", "Total cost of keys evicted from the cache.",
+				(*ristretto.Metrics).CostEvicted,
+			),
+			newCacheCounter(
+				"sets_dropped_total", "Number of cache sets dropped due to contention.",
+				(*ristretto.Metrics).SetsDropped,
+			),
+			newCacheCounter(
+				"sets_rejected_total", "Number of cache sets rejected by the admission policy.",
+				(*ristretto.Metrics).SetsRejected,
+			),
+		},
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, counter := range c.counters {
+		ch <- prometheus.MustNewConstMetric(
+			counter.desc, prometheus.CounterValue, float64(counter.value(c.metrics)),
+		)
+	}
+}
+
+// Health
+
+// healthStatuses are the health statuses reported for apps with health checks.
+var healthStatuses = []health.Status{
+	health.StatusUp, health.StatusDegraded, health.StatusDown, health.StatusStarting,
+}
+
+// healthCollector exports the results of the most recent health checks of registered apps.
+type healthCollector struct {
+	hc *health.Client
+	l  godest.Logger
+
+	status  *prometheus.Desc
+	latency *prometheus.Desc
+}
+
+func newHealthCollector(hc *health.Client, l godest.Logger) *healthCollector {
+	return &healthCollector{
+		hc: hc,
+		l:  l,
+		status: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "app", "health_status"),
+			"Whether the app's most recent health check had the status (1) or not (0).",
+			[]string{"app", "status"}, nil,
+		),
+		latency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "app", "health_latency_seconds"),
+			"Time taken by the app's most recent health check.",
+			[]string{"app"}, nil,
+		),
+	}
+}
+
+func (c *healthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.status
+	ch <- c.latency
+}
+
+func (c *healthCollector) Collect(ch chan<- prometheus.Metric) {
+	results, err := c.hc.GetResults()
+	if err != nil {
+		c.l.Error(errors.Wrap(err, "couldn't get app health results for metrics"))
+		return
+	}
+	for appID, result := range results {
+		for _, status := range healthStatuses {
+			value := 0.0
+			if result.Status == status {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.status, prometheus.GaugeValue, value, appID, string(status),
+			)
+		}
+		if !result.Checked.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				c.latency, prometheus.GaugeValue, result.Latency.Seconds(), appID,
+			)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package metrics exports Prometheus metrics about the device portal's HTTP server, its client
+// cache, and its clients
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/openUC2/device-portal/internal/app/server/client"
+)
+
+// URLPath is the path of the metrics endpoint.
+const URLPath = "/metrics"
+
+const namespace = "device_portal"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// New makes a registry with metrics about the Go runtime, the process, the build, the client
+// cache, and the clients in the globals, and with metrics about HTTP requests which are updated by
+// the middleware returned by the Middleware method.
+func New(g *client.Globals) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests handled, by route and status code.",
+		}, []string{"method", "route", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewBuildInfoCollector(),
+		m.requests,
+		m.latency,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "build_info",
+			Help:        "Always 1, labeled by the version of the device portal.",
+			ConstLabels: prometheus.Labels{"version": g.Config.Version},
+		}, func() float64 { return 1 }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "machinename",
+			Name:      "lookup_failures_total",
+			Help:      "Number of times the machine name couldn't be determined.",
+		}, func() float64 { return float64(g.MachineName.LookupFailures()) }),
+		newHealthCollector(g.Health, g.Base.Logger),
+	)
+	if g.Base.CacheMetrics != nil {
+		m.Registry.MustRegister(newCacheCollector(g.Base.CacheMetrics))
+	}
+	return m
+}
+
+// Handler returns a handler for the metrics endpoint.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware returns middleware which counts and times HTTP requests. Requests are labeled by
+// their route pattern (e.g. /apps/:id) rather than by their path, so that the number of label
+// values is bounded.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				// The error hasn't been handled yet, so the response's status isn't final
+				status = http.StatusInternalServerError
+				var herr *echo.HTTPError
+				if errors.As(err, &herr) {
+					status = herr.Code
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			labels := prometheus.Labels{
+				"method": c.Request().Method, "route": route, "status": strconv.Itoa(status),
+			}
+			m.requests.With(labels).Inc()
+			m.latency.With(labels).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/routes/api"
+	"github.com/openUC2/device-portal/internal/app/server/routes/assets"
+	"github.com/openUC2/device-portal/internal/app/server/routes/health"
+	"github.com/openUC2/device-portal/internal/app/server/routes/streams"
+)
+
+// newRateLimiter makes middleware which limits the rate of requests from each client with a token
+// bucket for the budget. Clients are identified by their real IP addresses, which are only taken
+// from the X-Forwarded-For header for requests from trusted reverse-proxies.
+func newRateLimiter(
+	budget conf.RateLimitBudget, config conf.RateLimitConfig, skipper middleware.Skipper,
+) echo.MiddlewareFunc {
+	// A client which was denied gets another token after this many seconds
+	retryAfter := strconv.Itoa(max(1, int(math.Ceil(1/budget.Rate))))
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: skipper,
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(budget.Rate),
+			Burst:     budget.Burst,
+			ExpiresIn: config.ExpiresIn,
+		}),
+		DenyHandler: func(c echo.Context, _ string, _ error) error {
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return echo.NewHTTPError(http.StatusTooManyRequests)
+		},
+	})
+}
+
+// A routeClass is a class of routes which share a rate limit budget.
+type routeClass int
+
+const (
+	routeClassPage routeClass = iota
+	routeClassAsset
+	routeClassAPI
+	// routeClassExempt is for routes which aren't rate-limited: event streams (which stay open for
+	// as long as a page is open, and which browsers reconnect to automatically) and health checks
+	// (which are polled by probes).
+	routeClassExempt
+)
+
+// classifyRoute determines which rate limit budget applies to the request.
+func classifyRoute(r *http.Request, basePath string) routeClass {
+	if strings.HasPrefix(r.URL.Path, basePath+streams.URLPrefix) ||
+		strings.HasPrefix(r.URL.Path, basePath+health.URLPrefix) {
+		return routeClassExempt
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return routeClassAPI
+	}
+	if strings.HasPrefix(r.URL.Path, basePath+api.URLPrefix) {
+		return routeClassAPI
+	}
+	assetPrefixes := []string{
+		basePath + assets.AppURLPrefix, basePath + assets.StaticURLPrefix,
+		basePath + assets.FontsURLPrefix, basePath + "/favicon.ico",
+	}
+	for _, prefix := range assetPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return routeClassAsset
+		}
+	}
+	return routeClassPage
+}
+
+// configureRateLimiting adds middleware which limits the rate of requests from each client, with
+// separate budgets for pages, assets, and the API.
+func (s *Server) configureRateLimiting(e *echo.Echo) {
+	config := s.Globals.Config.RateLimit
+	if !config.Enabled {
+		return
+	}
+	if len(s.Globals.Config.HTTP.TrustedProxies) == 0 {
+		s.Logger.Warn(
+			"rate limiting is enabled but no reverse-proxies are trusted, so all clients behind a " +
+				"reverse-proxy will share the reverse-proxy's rate limits",
+		)
+	}
+	basePath := s.Globals.Config.HTTP.BasePath
+	budgets := []struct {
+		class  routeClass
+		budget conf.RateLimitBudget
+	}{
+		{class: routeClassPage, budget: config.Pages},
+		{class: routeClassAsset, budget: config.Assets},
+		{class: routeClassAPI, budget: config.API},
+	}
+	for _, b := range budgets {
+		if b.budget.Rate <= 0 {
+			continue // requests of this class aren't limited
+		}
+		e.Use(newRateLimiter(b.budget, config, func(c echo.Context) bool {
+			return classifyRoute(c.Request(), basePath) != b.class
+		}))
+	}
+}
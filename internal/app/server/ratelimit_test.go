@@ -0,0 +1,100 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/openUC2/device-portal/internal/app/server/client"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+)
+
+func newRateLimitedEcho(t *testing.T, trustedProxies []netip.Prefix) *echo.Echo {
+	t.Helper()
+	s := &Server{
+		Globals: &client.Globals{Config: conf.Config{
+			HTTP: conf.HTTPConfig{TrustedProxies: trustedProxies},
+			RateLimit: conf.RateLimitConfig{
+				Enabled:   true,
+				Pages:     conf.RateLimitBudget{Rate: 1, Burst: 2},
+				Assets:    conf.RateLimitBudget{Rate: 1, Burst: 2},
+				API:       conf.RateLimitBudget{Rate: 1, Burst: 2},
+				ExpiresIn: time.Minute,
+			},
+		}},
+		Logger: logging.NewLogger(logging.Config{}, io.Discard),
+	}
+	e := echo.New()
+	s.configureProxies(e)
+	s.configureRateLimiting(e)
+	for _, path := range []string{"/", "/streams/apps/health", "/health/apps"} {
+		e.GET(path, func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+	}
+	return e
+}
+
+// get sends a request for the path from the remote address, with an X-Forwarded-For header if
+// forwardedFor isn't empty, and returns the response's status code.
+func get(e *echo.Echo, path, remoteAddr, forwardedFor string) int {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		r.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRateLimitingBehindProxy(t *testing.T) {
+	t.Parallel()
+	const proxy = "127.0.0.1:50000"
+	e := newRateLimitedEcho(t, []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+
+	// Clients behind the trusted reverse-proxy have separate budgets
+	for range 2 {
+		if code := get(e, "/", proxy, "192.168.1.10"); code != http.StatusOK {
+			t.Fatalf("got status %d within the budget, expected %d", code, http.StatusOK)
+		}
+	}
+	if code := get(e, "/", proxy, "192.168.1.10"); code != http.StatusTooManyRequests {
+		t.Errorf("got status %d over the budget, expected %d", code, http.StatusTooManyRequests)
+	}
+	if code := get(e, "/", proxy, "192.168.1.11"); code != http.StatusOK {
+		t.Errorf("got status %d for another client, expected %d", code, http.StatusOK)
+	}
+
+	// Event streams and health checks aren't limited
+	for _, path := range []string{"/streams/apps/health", "/health/apps"} {
+		for range 5 {
+			if code := get(e, path, proxy, "192.168.1.10"); code != http.StatusOK {
+				t.Fatalf("got status %d for %s, expected %d", code, path, http.StatusOK)
+			}
+		}
+	}
+}
+
+func TestRateLimitingUntrustedProxy(t *testing.T) {
+	t.Parallel()
+	const proxy = "127.0.0.1:50000"
+	e := newRateLimitedEcho(t, nil)
+
+	// Without trusted reverse-proxies, clients can't be told apart by X-Forwarded-For headers, which
+	// can be spoofed
+	for range 2 {
+		if code := get(e, "/", proxy, "192.168.1.10"); code != http.StatusOK {
+			t.Fatalf("got status %d within the budget, expected %d", code, http.StatusOK)
+		}
+	}
+	if code := get(e, "/", proxy, "192.168.1.11"); code != http.StatusTooManyRequests {
+		t.Errorf("got status %d for a spoofed client, expected %d", code, http.StatusTooManyRequests)
+	}
+}
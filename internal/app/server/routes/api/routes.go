@@ -0,0 +1,255 @@
+// Package api contains the route handlers for the device portal's JSON API, which provides the
+// same information as the home page for programmatic use (e.g. by lab automation scripts or by
+// other apps on the machine).
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/health"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+// URLPrefix is the path prefix of the current version of the API. Backwards-incompatible changes
+// to the API must be made under a new path prefix.
+const URLPrefix = "/api/v1"
+
+type Handlers struct {
+	version    string
+	httpConfig conf.HTTPConfig
+	mnc        *machinename.Client
+	ac         *apps.Client
+	hc         *health.Client
+}
+
+func New(
+	version string, httpConfig conf.HTTPConfig,
+	mnc *machinename.Client, ac *apps.Client, hc *health.Client,
+) *Handlers {
+	return &Handlers{
+		version:    version,
+		httpConfig: httpConfig,
+		mnc:        mnc,
+		ac:         ac,
+		hc:         hc,
+	}
+}
+
+func (h *Handlers) Register(er godest.EchoRouter) {
+	// Other apps on the machine might be served from other origins (e.g. directly from their own
+	// ports), and the API only exposes read-only information which is also shown on the home page
+	cors := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{http.MethodGet, http.MethodHead},
+	})
+	er.GET(URLPrefix, h.HandleIndexGet(), cors)
+	er.GET(URLPrefix+"/machine", h.HandleMachineGet(), cors)
+	er.GET(URLPrefix+"/apps", h.HandleAppsGet(), cors)
+	er.GET(URLPrefix+"/apps/:id", h.HandleAppGet(), cors)
+}
+
+// Data
+
+type MachineData struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	Port     string `json:"port,omitempty"`
+	// Kind is the kind of hostname which was used to access the API.
+	Kind accesspath.Kind `json:"kind"`
+	// MachineSpecific is whether the hostname can only refer to the machine, rather than to
+	// whichever machine happens to respond to it (e.g. openuc2.local).
+	MachineSpecific bool `json:"machineSpecific"`
+	// Alternatives are the URLs of the device portal's home page which can be used to access the
+	// machine, including the URL at the hostname which was used to access the API.
+	Alternatives []AlternativeData `json:"alternatives"`
+	Version      string            `json:"version"`
+}
+
+type AlternativeData struct {
+	Hostname        string          `json:"hostname"`
+	URL             string          `json:"url"`
+	Kind            accesspath.Kind `json:"kind"`
+	MachineSpecific bool            `json:"machineSpecific"`
+	// Current is whether the hostname is the one which was used to access the API.
+	Current bool `json:"current"`
+}
+
+func (h *Handlers) getAccessPath(r *http.Request) (accesspath.AccessPath, error) {
+	machineName, err := h.mnc.GetName()
+	if err != nil {
+		return accesspath.AccessPath{}, err
+	}
+	access, err := accesspath.FromRequest(
+		r, h.httpConfig.BasePath, machineName, h.httpConfig.TrustsProxy(r.RemoteAddr),
+	)
+	if err != nil {
+		return accesspath.AccessPath{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return access, nil
+}
+
+func (h *Handlers) getMachineData(r *http.Request) (d MachineData, err error) {
+	if d.Name, err = h.mnc.GetName(); err != nil {
+		return MachineData{}, err
+	}
+	access, err := h.getAccessPath(r)
+	if err != nil {
+		return MachineData{}, err
+	}
+	d.Hostname = access.Hostname
+	d.Port = access.Port
+	d.Kind = access.Kind
+	d.MachineSpecific = access.MachineSpecific
+	d.Alternatives = make([]AlternativeData, 0, len(access.Alternatives))
+	for _, alternative := range access.Alternatives {
+		d.Alternatives = append(d.Alternatives, AlternativeData{
+			Hostname:        alternative.Hostname,
+			URL:             alternative.URL,
+			Kind:            alternative.Kind,
+			MachineSpecific: alternative.MachineSpecific,
+			Current:         alternative.Current,
+		})
+	}
+	d.Version = h.version
+	return d, nil
+}
+
+type AppData struct {
+	apps.App
+	// Href is the link to the app, resolved relative to the hostname used to access the API.
+	Href string `json:"href,omitempty"`
+	// Status is the result of the app's most recent health check, if the app has a health check.
+	Status *health.Result `json:"status,omitempty"`
+}
+
+func (h *Handlers) getAppData(app apps.App, hostname string) AppData {
+	d := AppData{
+		App:  app,
+		Href: app.Href(hostname),
+	}
+	if app.Health != nil {
+		result := h.hc.GetResult(app)
+		d.Status = &result
+	}
+	return d
+}
+
+func (h *Handlers) getAppsData(hostname string, filter func(apps.App) bool) ([]AppData, error) {
+	registry, err := h.ac.GetRegistry()
+	if err != nil {
+		return nil, err
+	}
+	appsData := make([]AppData, 0, len(registry.Apps))
+	for _, app := range registry.Apps {
+		if filter != nil && !filter(app) {
+			continue
+		}
+		appsData = append(appsData, h.getAppData(app, hostname))
+	}
+	return appsData, nil
+}
+
+// Handlers
+
+type IndexData struct {
+	Machine MachineData `json:"machine"`
+	Apps    []AppData   `json:"apps"`
+}
+
+func (h *Handlers) HandleIndexGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Run queries
+		machineData, err := h.getMachineData(c.Request())
+		if err != nil {
+			return err
+		}
+		appsData, err := h.getAppsData(machineData.Hostname, nil)
+		if err != nil {
+			return err
+		}
+		// Produce output
+		godest.WithAlwaysRevalidate()(c.Response().Header())
+		return c.JSON(http.StatusOK, IndexData{
+			Machine: machineData,
+			Apps:    appsData,
+		})
+	}
+}
+
+func (h *Handlers) HandleMachineGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Run queries
+		machineData, err := h.getMachineData(c.Request())
+		if err != nil {
+			return err
+		}
+		// Produce output
+		godest.WithAlwaysRevalidate()(c.Response().Header())
+		return c.JSON(http.StatusOK, machineData)
+	}
+}
+
+type AppsData struct {
+	Apps []AppData `json:"apps"`
+}
+
+func (h *Handlers) HandleAppsGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Parse params
+		category := apps.Category(c.QueryParam("category"))
+		if category != "" && !category.Valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown category")
+		}
+		audience := apps.Audience(c.QueryParam("audience"))
+		if audience != "" && !audience.Valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown audience")
+		}
+
+		// Run queries
+		access, err := h.getAccessPath(c.Request())
+		if err != nil {
+			return err
+		}
+		appsData, err := h.getAppsData(access.Hostname, func(app apps.App) bool {
+			return (category == "" || app.Category == category) &&
+				(audience == "" || app.Audience == audience)
+		})
+		if err != nil {
+			return err
+		}
+		// Produce output
+		godest.WithAlwaysRevalidate()(c.Response().Header())
+		return c.JSON(http.StatusOK, AppsData{Apps: appsData})
+	}
+}
+
+func (h *Handlers) HandleAppGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Parse params
+		id := c.Param("id")
+
+		// Run queries
+		registry, err := h.ac.GetRegistry()
+		if err != nil {
+			return err
+		}
+		app, ok := registry.Get(id)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "app not found")
+		}
+		access, err := h.getAccessPath(c.Request())
+		if err != nil {
+			return err
+		}
+		// Produce output
+		godest.WithAlwaysRevalidate()(c.Response().Header())
+		return c.JSON(http.StatusOK, h.getAppData(app, access.Hostname))
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/labstack/echo/v4"
+	"github.com/sargassum-world/godest/clientcache"
+
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+func newTestEcho(t *testing.T, machineName string) *echo.Echo {
+	t.Helper()
+	nameFile := filepath.Join(t.TempDir(), "machine-name")
+	if err := os.WriteFile(nameFile, []byte(machineName+"\n"), 0o600); err != nil {
+		t.Fatalf("couldn't write machine name file: %s", err)
+	}
+	cache, err := clientcache.NewRistrettoCache(ristretto.Config{
+		NumCounters: 1e3, MaxCost: 1e6, BufferItems: 64,
+	})
+	if err != nil {
+		t.Fatalf("couldn't make cache: %s", err)
+	}
+	l := logging.NewLogger(logging.Config{}, io.Discard)
+	mnc := machinename.NewClient(machinename.Config{NameFile: nameFile}, cache, l)
+
+	e := echo.New()
+	New("v1.2.3", conf.HTTPConfig{}, mnc, nil, nil).Register(e)
+	return e
+}
+
+func TestMachineGet(t *testing.T) {
+	t.Parallel()
+	alternatives := func(current string) []AlternativeData {
+		alternatives := []AlternativeData{
+			{
+				Hostname:        "openuc2-abc123.local",
+				URL:             "http://openuc2-abc123.local:3001/",
+				Kind:            accesspath.KindMDNS,
+				MachineSpecific: true,
+			},
+			{
+				Hostname:        "abc123.uc2",
+				URL:             "http://abc123.uc2:3001/",
+				Kind:            accesspath.KindHotspot,
+				MachineSpecific: true,
+			},
+			{
+				Hostname: "openuc2.local",
+				URL:      "http://openuc2.local:3001/",
+				Kind:     accesspath.KindMDNS,
+			},
+		}
+		for i := range alternatives {
+			alternatives[i].Current = alternatives[i].Hostname == current
+		}
+		return alternatives
+	}
+	for _, tc := range []struct {
+		host     string
+		expected MachineData
+	}{
+		{
+			host: "openuc2-abc123.local:3001",
+			expected: MachineData{
+				Hostname:        "openuc2-abc123.local",
+				Kind:            accesspath.KindMDNS,
+				MachineSpecific: true,
+				Alternatives:    alternatives("openuc2-abc123.local"),
+			},
+		},
+		{
+			host: "abc123.uc2:3001",
+			expected: MachineData{
+				Hostname:        "abc123.uc2",
+				Kind:            accesspath.KindHotspot,
+				MachineSpecific: true,
+				Alternatives:    alternatives("abc123.uc2"),
+			},
+		},
+		{
+			host: "openuc2.local:3001",
+			expected: MachineData{
+				Hostname:     "openuc2.local",
+				Kind:         accesspath.KindMDNS,
+				Alternatives: alternatives("openuc2.local"),
+			},
+		},
+		{
+			host: "192.168.4.1:3001",
+			expected: MachineData{
+				Hostname:        "192.168.4.1",
+				Kind:            accesspath.KindIP,
+				MachineSpecific: true,
+				Alternatives:    alternatives(""),
+			},
+		},
+	} {
+		t.Run(tc.host, func(t *testing.T) {
+			t.Parallel()
+			e := newTestEcho(t, "abc123")
+			r := httptest.NewRequest(http.MethodGet, URLPrefix+"/machine", nil)
+			r.Host = tc.host
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, expected %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var d MachineData
+			if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+				t.Fatalf("couldn't parse response: %s", err)
+			}
+			expected := tc.expected
+			expected.Name = "abc123"
+			expected.Port = "3001"
+			expected.Version = "v1.2.3"
+			if !reflect.DeepEqual(d, expected) {
+				t.Errorf("got %+v, expected %+v", d, expected)
+			}
+		})
+	}
+}
+
+func TestMachineGetInvalidHost(t *testing.T) {
+	t.Parallel()
+	e := newTestEcho(t, "abc123")
+	r := httptest.NewRequest(http.MethodGet, URLPrefix+"/machine", nil)
+	r.Host = "[openuc2.local]"
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -28,18 +28,24 @@ func (h *TemplatedHandlers) Register(er godest.EchoRouter) {
 	er.GET(AppURLPrefix+"app.webmanifest", h.getWebmanifest())
 }
 
-func RegisterStatic(er godest.EchoRouter, em godest.Embeds) {
+// RegisterStatic registers routes for static assets on the router, which should serve the routes
+// under the base path.
+func RegisterStatic(er godest.EchoRouter, basePath string, em godest.Embeds) {
 	const (
 		day  = 24 * time.Hour
 		week = 7 * day
 		year = 365 * day
 	)
 
-	er.GET("/favicon.ico", echo.WrapHandler(godest.HandleFS("/", em.StaticFS, week)))
-	er.GET(FontsURLPrefix+"*", echo.WrapHandler(godest.HandleFS(FontsURLPrefix, em.FontsFS, year)))
-	er.GET(
-		StaticURLPrefix+"*",
-		echo.WrapHandler(godest.HandleFSFileRevved(StaticURLPrefix, em.StaticHFS)),
-	)
-	er.GET(AppURLPrefix+"*", echo.WrapHandler(godest.HandleFSFileRevved(AppURLPrefix, em.AppHFS)))
+	// The handlers see the full request path, so they need to strip the base path too
+	er.GET("/favicon.ico", echo.WrapHandler(godest.HandleFS(basePath+"/", em.StaticFS, week)))
+	er.GET(FontsURLPrefix+"*", echo.WrapHandler(
+		godest.HandleFS(basePath+FontsURLPrefix, em.FontsFS, year),
+	))
+	er.GET(StaticURLPrefix+"*", echo.WrapHandler(
+		godest.HandleFSFileRevved(basePath+StaticURLPrefix, em.StaticHFS),
+	))
+	er.GET(AppURLPrefix+"*", echo.WrapHandler(
+		godest.HandleFSFileRevved(basePath+AppURLPrefix, em.AppHFS),
+	))
 }
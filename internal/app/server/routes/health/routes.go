@@ -0,0 +1,69 @@
+// Package health contains the route handlers for reporting the health of registered apps.
+package health
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	apphealth "github.com/openUC2/device-portal/internal/clients/health"
+)
+
+// URLPrefix is the path prefix of the health routes.
+const URLPrefix = "/health/"
+
+type Handlers struct {
+	ac *apps.Client
+	hc *apphealth.Client
+}
+
+func New(ac *apps.Client, hc *apphealth.Client) *Handlers {
+	return &Handlers{
+		ac: ac,
+		hc: hc,
+	}
+}
+
+func (h *Handlers) Register(er godest.EchoRouter) {
+	er.GET(URLPrefix+"apps", h.HandleAppsGet())
+	er.GET(URLPrefix+"apps/:id", h.HandleAppGet())
+}
+
+type AppsViewData struct {
+	Apps map[string]apphealth.Result `json:"apps"`
+}
+
+func (h *Handlers) HandleAppsGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Run queries
+		results, err := h.hc.GetResults()
+		if err != nil {
+			return err
+		}
+		// Produce output
+		godest.WithUncacheable()(c.Response().Header())
+		return c.JSON(http.StatusOK, AppsViewData{Apps: results})
+	}
+}
+
+func (h *Handlers) HandleAppGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Parse params
+		id := c.Param("id")
+
+		// Run queries
+		registry, err := h.ac.GetRegistry()
+		if err != nil {
+			return err
+		}
+		app, ok := registry.Get(id)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "app not found")
+		}
+		// Produce output
+		godest.WithUncacheable()(c.Response().Header())
+		return c.JSON(http.StatusOK, h.hc.GetResult(app))
+	}
+}
@@ -2,51 +2,70 @@
 package home
 
 import (
-	"strings"
-
 	"github.com/labstack/echo/v4"
-	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/turbostreams"
 
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/routes/streams"
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/health"
 	"github.com/openUC2/device-portal/internal/clients/machinename"
 )
 
 type Handlers struct {
-	r   godest.TemplateRenderer
-	mnc *machinename.Client
+	r          godest.TemplateRenderer
+	httpConfig conf.HTTPConfig
+	mnc        *machinename.Client
+	ac         *apps.Client
+	hc         *health.Client
 }
 
-func New(r godest.TemplateRenderer, mnc *machinename.Client) *Handlers {
+func New(
+	r godest.TemplateRenderer, httpConfig conf.HTTPConfig,
+	mnc *machinename.Client, ac *apps.Client, hc *health.Client,
+) *Handlers {
 	return &Handlers{
-		r:   r,
-		mnc: mnc,
+		r:          r,
+		httpConfig: httpConfig,
+		mnc:        mnc,
+		ac:         ac,
+		hc:         hc,
 	}
 }
 
-func (h *Handlers) Register(er godest.EchoRouter) {
+func (h *Handlers) Register(er godest.EchoRouter, tsr turbostreams.Router) {
 	er.GET("/", h.HandleHomeGet())
+	tsr.SUB("/apps/registry", turbostreams.EmptyHandler)
+	tsr.UNSUB("/apps/registry", turbostreams.EmptyHandler)
+	tsr.PUB("/apps/registry", h.HandleAppsRegistryPub())
+	tsr.SUB("/apps/health", turbostreams.EmptyHandler)
+	tsr.UNSUB("/apps/health", turbostreams.EmptyHandler)
+	tsr.PUB("/apps/health", h.HandleAppsHealthPub())
 }
 
 type HomeViewData struct {
-	Hostname    string
-	Port        string
+	Access      accesspath.AccessPath
 	MachineName string
+	Apps        apps.Registry
+	Health      map[string]health.Status
 }
 
-func getHomeViewData(host, machineName string) (vd HomeViewData, err error) {
-	split := strings.Split(host, ":")
-	const expectedComponents = 2
-	if len(split) > expectedComponents {
-		return HomeViewData{}, errors.Errorf(
-			"unable to split host '%s' into a hostname and a port", host,
-		)
-	}
-	vd.Hostname = split[0]
-	if len(split) == expectedComponents {
-		vd.Port = split[expectedComponents-1]
-	}
+func getHomeViewData(
+	access accesspath.AccessPath, machineName string,
+	registry apps.Registry, results map[string]health.Result,
+) (vd HomeViewData) {
+	vd.Access = access
 	vd.MachineName = machineName
-	return vd, nil
+	vd.Apps = registry
+	// We only include health statuses (rather than full health check results) so that the page's
+	// ETag only changes when an app's health status changes
+	vd.Health = make(map[string]health.Status, len(results))
+	for id, result := range results {
+		vd.Health[id] = result.Status
+	}
+	return vd
 }
 
 func (h *Handlers) HandleHomeGet() echo.HandlerFunc {
@@ -58,11 +77,58 @@ func (h *Handlers) HandleHomeGet() echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		homeViewData, err := getHomeViewData(c.Request().Host, machineName)
+		registry, err := h.ac.GetRegistry()
+		if err != nil {
+			return err
+		}
+		results, err := h.hc.GetResults()
+		if err != nil {
+			return err
+		}
+		access, err := accesspath.FromRequest(
+			c.Request(), h.httpConfig.BasePath, machineName,
+			h.httpConfig.TrustsProxy(c.Request().RemoteAddr),
+		)
 		if err != nil {
 			return err
 		}
+		homeViewData := getHomeViewData(access, machineName, registry, results)
 		// Produce output
 		return h.r.CacheablePage(c.Response(), c.Request(), t, homeViewData, struct{}{})
 	}
 }
+
+func (h *Handlers) HandleAppsRegistryPub() turbostreams.HandlerFunc {
+	return func(c *turbostreams.Context) error {
+		// Since any page listing apps might show the apps in many places, it's simplest to just
+		// make browsers reload the page
+		<-h.ac.Subscribe(c.Context(), func(_ apps.Registry) error {
+			c.Publish(turbostreams.Message{Action: streams.ActionRefresh})
+			return nil
+		})
+		return nil
+	}
+}
+
+// healthTargetPrefix is the prefix of the HTML element ID of each app's health status badge.
+const healthTargetPrefix = "app-health-"
+
+func (h *Handlers) HandleAppsHealthPub() turbostreams.HandlerFunc {
+	t := "home/health.partial.tmpl"
+	h.r.MustHave(t)
+	return func(c *turbostreams.Context) error {
+		<-h.hc.Subscribe(c.Context(), func(result health.Result) error {
+			c.Publish(turbostreams.Message{
+				Action:   turbostreams.ActionReplace,
+				Target:   healthTargetPrefix + result.AppID,
+				Template: t,
+				Data: map[string]any{
+					"ID":     result.AppID,
+					"Status": result.Status,
+				},
+			})
+			return nil
+		})
+		return nil
+	}
+}
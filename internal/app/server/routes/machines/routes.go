@@ -0,0 +1,54 @@
+// Package machines contains the route handlers related to other machines on the local network.
+package machines
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+	"github.com/openUC2/device-portal/internal/clients/mdns"
+)
+
+type Handlers struct {
+	r   godest.TemplateRenderer
+	mnc *machinename.Client
+	mc  *mdns.Client
+}
+
+func New(r godest.TemplateRenderer, mnc *machinename.Client, mc *mdns.Client) *Handlers {
+	return &Handlers{
+		r:   r,
+		mnc: mnc,
+		mc:  mc,
+	}
+}
+
+func (h *Handlers) Register(er godest.EchoRouter) {
+	er.GET("/machines", h.HandleMachinesGet())
+}
+
+type MachinesViewData struct {
+	MachineName string
+	// Enabled is whether discovery of machines over mDNS is enabled.
+	Enabled  bool
+	Machines []mdns.Machine
+}
+
+func (h *Handlers) HandleMachinesGet() echo.HandlerFunc {
+	t := "machines/index.page.tmpl"
+	h.r.MustHave(t)
+	return func(c echo.Context) error {
+		// Run queries
+		machineName, err := h.mnc.GetName()
+		if err != nil {
+			return err
+		}
+		machinesViewData := MachinesViewData{
+			MachineName: machineName,
+			Enabled:     h.mc.Config.Enabled,
+			Machines:    h.mc.GetMachines(),
+		}
+		// Produce output
+		return h.r.CacheablePage(c.Response(), c.Request(), t, machinesViewData, struct{}{})
+	}
+}
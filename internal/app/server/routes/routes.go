@@ -3,26 +3,55 @@ package routes
 
 import (
 	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/turbostreams"
 
 	"github.com/openUC2/device-portal/internal/app/server/client"
+	"github.com/openUC2/device-portal/internal/app/server/routes/api"
 	"github.com/openUC2/device-portal/internal/app/server/routes/assets"
+	"github.com/openUC2/device-portal/internal/app/server/routes/health"
 	"github.com/openUC2/device-portal/internal/app/server/routes/home"
+	"github.com/openUC2/device-portal/internal/app/server/routes/machines"
+	"github.com/openUC2/device-portal/internal/app/server/routes/streams"
+	"github.com/openUC2/device-portal/internal/app/server/routes/trust"
 )
 
 type Handlers struct {
 	r       godest.TemplateRenderer
 	globals *client.Globals
+
+	streams *streams.Handlers
 }
 
 func New(r godest.TemplateRenderer, globals *client.Globals) *Handlers {
 	return &Handlers{
 		r:       r,
 		globals: globals,
+		streams: streams.New(r, globals.Base.TSBroker),
 	}
 }
 
-func (h *Handlers) Register(er godest.EchoRouter, em godest.Embeds) {
-	assets.RegisterStatic(er, em)
+// Register registers all routes on the router, which should serve the routes under the base path.
+func (h *Handlers) Register(
+	er godest.EchoRouter, basePath string, tsr turbostreams.Router, em godest.Embeds,
+) {
+	assets.RegisterStatic(er, basePath, em)
 	assets.NewTemplated(h.r).Register(er)
-	home.New(h.r, h.globals.MachineName).Register(er)
+	h.streams.Register(er, tsr)
+	home.New(
+		h.r, h.globals.Config.HTTP, h.globals.MachineName, h.globals.Apps, h.globals.Health,
+	).Register(er, tsr)
+	machines.New(h.r, h.globals.MachineName, h.globals.MDNS).Register(er)
+	trust.New(
+		h.r, h.globals.Config.HTTP, h.globals.Config.HTTPS, h.globals.MachineName, h.globals.Certs,
+	).Register(er)
+	health.New(h.globals.Apps, h.globals.Health).Register(er)
+	api.New(
+		h.globals.Config.Version, h.globals.Config.HTTP,
+		h.globals.MachineName, h.globals.Apps, h.globals.Health,
+	).Register(er)
+}
+
+// CloseStreams ends all long-lived Turbo Streams connections, e.g. for a graceful shutdown.
+func (h *Handlers) CloseStreams() {
+	h.streams.Close()
 }
@@ -0,0 +1,152 @@
+// Package streams contains the route handlers for delivering Turbo Streams messages to web
+// browsers.
+package streams
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/turbostreams"
+)
+
+const URLPrefix = "/streams/"
+
+// ActionRefresh is the Turbo Stream action which makes the browser reload the current page.
+const ActionRefresh turbostreams.Action = "refresh"
+
+type Handlers struct {
+	r   godest.TemplateRenderer
+	tsb *turbostreams.Broker
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func New(r godest.TemplateRenderer, tsb *turbostreams.Broker) *Handlers {
+	return &Handlers{
+		r:       r,
+		tsb:     tsb,
+		closing: make(chan struct{}),
+	}
+}
+
+// Close ends all open event streams and makes any subsequent event streams end immediately, so
+// that the http server can shut down gracefully without waiting for browsers to disconnect from
+// long-lived event streams. Browsers will automatically try to reconnect to closed event streams.
+func (h *Handlers) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closing)
+	})
+}
+
+func (h *Handlers) Register(er godest.EchoRouter, tsr turbostreams.Router) {
+	er.GET(URLPrefix+"*", h.HandleStreamGet())
+	tsr.MSG("/*", h.HandleStreamMsg)
+}
+
+// Server-Sent Events
+
+// keepaliveInterval is the interval between comments sent over idle event streams, to prevent
+// reverse-proxies from closing idle connections.
+const keepaliveInterval = 30 * time.Second
+
+func (h *Handlers) HandleStreamGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		streamName := "/" + c.Param("*")
+		ctx := c.Request().Context()
+		rendered := make(chan string)
+		finished := h.tsb.Subscribe(
+			ctx, streamName, "", func(ctx context.Context, message string) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case rendered <- message:
+					return nil
+				}
+			},
+		)
+		if finished == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "stream not found")
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.WriteHeader(http.StatusOK)
+		res.Flush()
+		keepalive := time.NewTicker(keepaliveInterval)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-finished:
+				return nil
+			case <-h.closing:
+				return nil
+			case <-keepalive.C:
+				if _, err := io.WriteString(res, ": keepalive\n\n"); err != nil {
+					return nil // the client has disconnected
+				}
+			case message := <-rendered:
+				if err := writeEvent(res, message); err != nil {
+					return nil // the client has disconnected
+				}
+			}
+			res.Flush()
+		}
+	}
+}
+
+// writeEvent writes the message as a server-sent event.
+func writeEvent(w io.Writer, message string) error {
+	var b strings.Builder
+	for line := range strings.Lines(message) {
+		b.WriteString("data: ")
+		b.WriteString(strings.TrimRight(line, "\r\n"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Turbo Streams messages
+
+// HandleStreamMsg renders published Turbo Streams messages on any stream.
+func (h *Handlers) HandleStreamMsg(c *turbostreams.Context) error {
+	pending := make([]turbostreams.Message, 0, len(c.Published()))
+	for _, message := range c.Published() {
+		if message.Action != ActionRefresh {
+			pending = append(pending, message)
+			continue
+		}
+		// The refresh action doesn't have any template to render, so godest can't render it for us
+		if err := h.writeMessages(c.MsgWriter(), pending); err != nil {
+			return err
+		}
+		pending = pending[:0]
+		if _, err := io.WriteString(
+			c.MsgWriter(), `<turbo-stream action="`+string(ActionRefresh)+`"></turbo-stream>`,
+		); err != nil {
+			return errors.Wrap(err, "couldn't render turbo streams refresh message")
+		}
+	}
+	return h.writeMessages(c.MsgWriter(), pending)
+}
+
+func (h *Handlers) writeMessages(w io.Writer, messages []turbostreams.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.Wrap(
+		h.r.WriteTurboStream(w, messages...), "couldn't render turbo streams messages",
+	)
+}
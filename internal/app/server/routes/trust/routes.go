@@ -0,0 +1,276 @@
+// Package trust contains the route handlers for onboarding web browsers to trust the machine's
+// local certificate authority.
+package trust
+
+import (
+	"crypto/sha1" //nolint:gosec // SHA-1 fingerprints are only shown for comparison with OS dialogs
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/clients/certs"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+// URLPrefix is the path prefix of the trust-onboarding routes, which are served over HTTP even if
+// the HTTP server otherwise redirects to the HTTPS server, so that browsers which don't trust the
+// machine yet can still download its certificate authority.
+const URLPrefix = "/trust"
+
+type Handlers struct {
+	r           godest.TemplateRenderer
+	httpConfig  conf.HTTPConfig
+	httpsConfig conf.HTTPSConfig
+	mnc         *machinename.Client
+	cc          *certs.Client
+}
+
+func New(
+	r godest.TemplateRenderer, httpConfig conf.HTTPConfig, httpsConfig conf.HTTPSConfig,
+	mnc *machinename.Client, cc *certs.Client,
+) *Handlers {
+	return &Handlers{
+		r:           r,
+		httpConfig:  httpConfig,
+		httpsConfig: httpsConfig,
+		mnc:         mnc,
+		cc:          cc,
+	}
+}
+
+func (h *Handlers) Register(er godest.EchoRouter) {
+	er.GET(URLPrefix, h.HandleTrustGet())
+	er.GET(URLPrefix+"/ca.pem", h.HandleCAPEMGet())
+	er.GET(URLPrefix+"/ca.crt", h.HandleCADERGet())
+	er.GET(URLPrefix+"/ca.mobileconfig", h.HandleCAMobileconfigGet())
+}
+
+// CA
+
+type CAViewData struct {
+	// Name is the common name of the certificate authority, as shown by operating systems.
+	Name     string
+	NotAfter time.Time
+	// Hostnames are the only hostnames which the certificate authority can issue certificates for.
+	Hostnames []string
+	// SHA256Fingerprint and SHA1Fingerprint are fingerprints of the certificate authority's
+	// certificate, for users to check that they're trusting the right certificate authority.
+	SHA256Fingerprint string
+	SHA1Fingerprint   string
+	// DERBase64 is the base64-encoded DER encoding of the certificate.
+	DERBase64 string
+	// ProfileUUID and PayloadUUID are UUIDs for the Apple configuration profile which installs the
+	// certificate authority, derived from the certificate so that they're stable.
+	ProfileUUID string
+	PayloadUUID string
+}
+
+func newCAViewData(ca *x509.Certificate) CAViewData {
+	sha256Sum := sha256.Sum256(ca.Raw)
+	sha1Sum := sha1.Sum(ca.Raw) //nolint:gosec // see the import of crypto/sha1
+	payloadSum := sha256.Sum256(append([]byte("payload:"), ca.Raw...))
+	return CAViewData{
+		Name:              ca.Subject.CommonName,
+		NotAfter:          ca.NotAfter,
+		Hostnames:         ca.PermittedDNSDomains,
+		SHA256Fingerprint: formatFingerprint(sha256Sum[:]),
+		SHA1Fingerprint:   formatFingerprint(sha1Sum[:]),
+		DERBase64:         base64.StdEncoding.EncodeToString(ca.Raw),
+		ProfileUUID:       formatUUID(sha256Sum[:]),
+		PayloadUUID:       formatUUID(payloadSum[:]),
+	}
+}
+
+// formatFingerprint formats a certificate fingerprint as colon-separated pairs of uppercase
+// hexadecimal digits, as shown by most operating systems.
+func formatFingerprint(sum []byte) string {
+	pairs := make([]string, 0, len(sum))
+	for _, b := range sum {
+		pairs = append(pairs, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(pairs, ":")
+}
+
+// formatUUID formats the start of a hash as a version 8 (i.e. custom) UUID.
+func formatUUID(sum []byte) string {
+	const (
+		uuidLength     = 16
+		versionByte    = 6
+		versionMask    = 0x0f
+		version8       = 0x80
+		variantByte    = 8
+		variantMask    = 0x3f
+		variantRFC9562 = 0x80
+	)
+	b := make([]byte, uuidLength)
+	copy(b, sum)
+	b[versionByte] = (b[versionByte] & versionMask) | version8
+	b[variantByte] = (b[variantByte] & variantMask) | variantRFC9562
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// getCA returns the machine's certificate authority, or a Not Found error if the machine doesn't
+// have a local certificate authority.
+func (h *Handlers) getCA() (*x509.Certificate, error) {
+	ca, err := h.cc.GetCA()
+	if err != nil {
+		return nil, err
+	}
+	if ca == nil {
+		return nil, echo.NewHTTPError(
+			http.StatusNotFound, "this machine doesn't have a local certificate authority",
+		)
+	}
+	return ca, nil
+}
+
+// caFilename returns the filename for downloads of the certificate authority.
+func (h *Handlers) caFilename(extension string) (string, error) {
+	machineName, err := h.mnc.GetName()
+	if err != nil {
+		return "", err
+	}
+	if machineName == "" {
+		return "openuc2-ca" + extension, nil
+	}
+	return accesspath.MDNSHostnamePrefix + machineName + "-ca" + extension, nil
+}
+
+// Handlers
+
+type TrustViewData struct {
+	MachineName string
+	// Mode is the TLS mode of the HTTPS server.
+	Mode certs.Mode
+	// CA is the machine's local certificate authority, if it has one.
+	CA *CAViewData
+	// Secure is whether the page was accessed over HTTPS.
+	Secure bool
+	// HTTPSURL is the URL of the home page on the HTTPS server, at the hostname which was used to
+	// access the page.
+	HTTPSURL string
+}
+
+func (h *Handlers) HandleTrustGet() echo.HandlerFunc {
+	t := "trust/index.page.tmpl"
+	h.r.MustHave(t)
+	return func(c echo.Context) error {
+		// Parse params
+		r := c.Request()
+		forwarded := h.httpConfig.TrustsProxy(r.RemoteAddr)
+
+		// Run queries
+		machineName, err := h.mnc.GetName()
+		if err != nil {
+			return err
+		}
+		access, err := accesspath.FromRequest(r, h.httpConfig.BasePath, machineName, forwarded)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ca, err := h.cc.GetCA()
+		if err != nil {
+			return err
+		}
+		trustViewData := TrustViewData{
+			MachineName: machineName,
+			Mode:        h.cc.GetMode(),
+			Secure:      access.Scheme == "https",
+			HTTPSURL:    access.WithScheme("https", h.httpsConfig.URLPort(forwarded)).URL("/"),
+		}
+		if ca != nil {
+			caViewData := newCAViewData(ca)
+			trustViewData.CA = &caViewData
+		}
+
+		// Produce output
+		return h.r.CacheablePage(c.Response(), r, t, trustViewData, struct{}{})
+	}
+}
+
+func (h *Handlers) HandleCAPEMGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Run queries
+		ca, err := h.getCA()
+		if err != nil {
+			return err
+		}
+		filename, err := h.caFilename(".pem")
+		if err != nil {
+			return err
+		}
+
+		// Produce output
+		c.Response().Header().Set(echo.HeaderContentDisposition, attachment(filename))
+		return c.Blob(
+			http.StatusOK, "application/x-pem-file",
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}),
+		)
+	}
+}
+
+func (h *Handlers) HandleCADERGet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Run queries
+		ca, err := h.getCA()
+		if err != nil {
+			return err
+		}
+		filename, err := h.caFilename(".crt")
+		if err != nil {
+			return err
+		}
+
+		// Produce output
+		c.Response().Header().Set(echo.HeaderContentDisposition, attachment(filename))
+		return c.Blob(http.StatusOK, "application/x-x509-ca-cert", ca.Raw)
+	}
+}
+
+func (h *Handlers) HandleCAMobileconfigGet() echo.HandlerFunc {
+	t := "trust/ca.mobileconfig.tmpl"
+	h.r.MustHave(t)
+	return func(c echo.Context) error {
+		// Run queries
+		machineName, err := h.mnc.GetName()
+		if err != nil {
+			return err
+		}
+		ca, err := h.getCA()
+		if err != nil {
+			return err
+		}
+		filename, err := h.caFilename(".mobileconfig")
+		if err != nil {
+			return err
+		}
+		trustViewData := TrustViewData{
+			MachineName: machineName,
+			Mode:        h.cc.GetMode(),
+		}
+		caViewData := newCAViewData(ca)
+		trustViewData.CA = &caViewData
+
+		// Produce output
+		c.Response().Header().Set(echo.HeaderContentDisposition, attachment(filename))
+		return h.r.CacheablePage(
+			c.Response(), c.Request(), t, trustViewData, struct{}{},
+			godest.WithContentType("application/x-apple-aspen-config"),
+		)
+	}
+}
+
+// attachment returns a Content-Disposition header value for downloading a file.
+func attachment(filename string) string {
+	return fmt.Sprintf("attachment; filename=%q", filename)
+}
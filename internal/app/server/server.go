@@ -3,25 +3,38 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"html/template"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/benbjohnson/hashfs"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
 	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/handling"
 	gmw "github.com/sargassum-world/godest/middleware"
 	"github.com/unrolled/secure"
 	"github.com/unrolled/secure/cspbuilder"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
 	"github.com/openUC2/device-portal/internal/app/server/client"
 	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/app/server/metrics"
 	"github.com/openUC2/device-portal/internal/app/server/routes"
 	"github.com/openUC2/device-portal/internal/app/server/routes/assets"
+	"github.com/openUC2/device-portal/internal/app/server/routes/streams"
+	"github.com/openUC2/device-portal/internal/app/server/routes/trust"
 	"github.com/openUC2/device-portal/internal/app/server/tmplfunc"
+	"github.com/openUC2/device-portal/internal/overlayfs"
 	"github.com/openUC2/device-portal/web"
 )
 
@@ -31,45 +44,118 @@ type Server struct {
 	Inlines  godest.Inlines
 	Renderer godest.TemplateRenderer
 	Handlers *routes.Handlers
+	Logger   *logging.Logger
+	// Metrics is nil unless the metrics endpoint is enabled.
+	Metrics *metrics.Metrics
+
+	// metricsServer serves the metrics endpoint if it has a separate port. It's made by New (rather
+	// than by Run) so that Shutdown and Close can safely access it from other goroutines.
+	metricsServer *http.Server
 }
 
-func New(config conf.Config, logger godest.Logger) (s *Server, err error) {
-	s = &Server{}
+func New(config conf.Config, logger *logging.Logger) (s *Server, err error) {
+	s = &Server{Logger: logger}
 	if s.Globals, err = client.NewGlobals(config, logger); err != nil {
 		return nil, errors.Wrap(err, "couldn't make app globals")
 	}
 
+	s.Globals.Base.Templates.Validate = validateTemplates
+	if err = s.Globals.Base.Templates.Load(); err != nil {
+		// Invalid custom templates shouldn't take down the server
+		logger.Error(errors.Wrap(
+			err, "couldn't load custom templates, so only built-in templates are used",
+		))
+	}
 	s.Embeds = web.NewEmbeds()
-	templatesOverlay := &OverlayFS{
-		Upper: s.Globals.Base.Templates.GetFS(),
-		Lower: s.Embeds.TemplatesFS,
+	s.Embeds.TemplatesFS = overlayfs.New(s.Globals.Base.Templates.GetFS(), s.Embeds.TemplatesFS)
+	if paths := config.Branding.StaticPaths; len(paths) > 0 {
+		layers := append(overlayfs.DirLayers(paths), s.Embeds.StaticFS)
+		s.Embeds.StaticFS = overlayfs.New(layers...)
+		// The hashed names of static assets are computed from the overlay, so that custom static
+		// assets get different URLs from the built-in static assets which they override
+		s.Embeds.StaticHFS = hashfs.NewFS(s.Embeds.StaticFS)
 	}
-	s.Embeds.TemplatesFS = templatesOverlay
 	s.Inlines = web.NewInlines()
 	if s.Renderer, err = godest.NewLazyTemplateRenderer(
-		s.Embeds, s.Inlines, sprig.FuncMap(), tmplfunc.FuncMap(
-			tmplfunc.NewHashedNamers(assets.AppURLPrefix, assets.StaticURLPrefix, s.Embeds),
-		),
+		s.Embeds, s.Inlines, templateFuncs(config.HTTP.BasePath, config.Branding, s.Embeds)...,
 	); err != nil {
 		return nil, errors.Wrap(err, "couldn't make template renderer")
 	}
 
 	s.Handlers = routes.New(s.Renderer, s.Globals)
+	if config.Metrics.Enabled {
+		if s.Globals.Base.CacheMetrics == nil {
+			logger.Info("cache metrics won't be exported, since they're disabled in the cache config")
+		}
+		s.Metrics = metrics.New(s.Globals)
+		if config.Metrics.Port != 0 {
+			const readHeaderTimeout = 10 * time.Second
+			s.metricsServer = &http.Server{
+				Addr:              fmt.Sprintf(":%d", config.Metrics.Port),
+				Handler:           s.Metrics.Handler(),
+				ReadHeaderTimeout: readHeaderTimeout,
+			}
+		}
+	}
 	return s, err
 }
 
+// templateFuncs returns the functions which templates can use.
+func templateFuncs(
+	basePath string, branding conf.BrandingConfig, embeds godest.Embeds,
+) []template.FuncMap {
+	return []template.FuncMap{
+		sprig.FuncMap(),
+		tmplfunc.FuncMap(
+			basePath, branding,
+			tmplfunc.NewHashedNamers(basePath, assets.AppURLPrefix, assets.StaticURLPrefix, embeds),
+		),
+	}
+}
+
 // Echo
 
+// configureProxies determines how client IP addresses are extracted from requests, which are used
+// in request logs.
+func (s *Server) configureProxies(e *echo.Echo) {
+	trustedProxies := s.Globals.Config.HTTP.TrustedProxyRanges()
+	if len(trustedProxies) == 0 {
+		// Without trusted reverse-proxies, X-Forwarded-For headers can't be trusted
+		e.IPExtractor = echo.ExtractIPDirect()
+		return
+	}
+	// Echo trusts loopback, link-local, and private addresses by default, but the device portal is
+	// usually accessed from the local network, so we only trust the configured addresses
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false),
+	}
+	for _, ipRange := range trustedProxies {
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(options...)
+}
+
 func (s *Server) configureLogging(e *echo.Echo) {
+	e.Use(logging.RequestIDs(s.Logger))
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			err := ""
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.String("remote_ip", v.RemoteIP),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.Int64("size", v.ResponseSize),
+			}
 			if v.Error != nil {
-				err = v.Error.Error()
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			// The request's logger adds the request ID to the log record
+			l, ok := c.Logger().(*logging.Logger)
+			if !ok {
+				l = s.Logger
 			}
-			fmt.Printf("%s %s %s => (%d after %s) %d %s\n",
-				v.Method, v.URI, v.RemoteIP, v.ResponseSize, v.Latency, v.Status, err,
-			)
+			l.Slog().LogAttrs(c.Request().Context(), slog.LevelInfo, "handled request", attrs...)
 			return nil
 		},
 		LogLatency:      true,
@@ -82,7 +168,6 @@ func (s *Server) configureLogging(e *echo.Echo) {
 	}))
 	e.HideBanner = true
 	e.HidePort = true
-	e.Logger.SetLevel(log.INFO) // TODO: set level via env var
 }
 
 // turboDriveStyle is the stylesheet which Turbo Drive tries to install for its progress bar,
@@ -128,29 +213,104 @@ func (s *Server) configureHeaders(e *echo.Echo) error {
 			cspbuilder.BaseURI:        {"'none'"},
 			cspbuilder.FormAction:     {"'self'"},
 			cspbuilder.FrameAncestors: {"'none'"},
-			// TODO: add HTTPS-related settings for CSP, including upgrade-insecure-requests
 		},
 	}
 	csp, err := cspBuilder.Build()
 	if err != nil {
 		return errors.Wrap(err, "couldn't build content security policy")
 	}
+	// Pages served over HTTPS shouldn't load anything over HTTP; pages served over HTTP (e.g. the
+	// trust-onboarding page) can't have their requests upgraded, since the browser might not trust
+	// the HTTPS server yet
+	cspBuilder.Directives[cspbuilder.UpgradeInsecureRequests] = []string{}
+	cspHTTPS, err := cspBuilder.Build()
+	if err != nil {
+		return errors.Wrap(err, "couldn't build content security policy for https")
+	}
 
-	e.Use(echo.WrapMiddleware(secure.New(secure.Options{
-		// TODO: add HTTPS options
+	httpsConfig := s.Globals.Config.HTTPS
+	options := secure.Options{
+		// The Strict-Transport-Security header is only sent in HTTPS responses
+		STSSeconds:              int64(httpsConfig.HSTSMaxAge.Seconds()),
+		STSIncludeSubdomains:    httpsConfig.HSTSIncludeSubdomains,
+		STSPreload:              httpsConfig.HSTSPreload,
 		FrameDeny:               true,
 		ContentTypeNosniff:      true,
 		ContentSecurityPolicy:   csp,
 		ReferrerPolicy:          "no-referrer",
 		CrossOriginOpenerPolicy: "same-origin",
-	}).Handler))
+	}
+	secureHTTP := secure.New(options)
+	options.ContentSecurityPolicy = cspHTTPS
+	secureHTTPS := secure.New(options)
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		nextHTTP := echo.WrapMiddleware(secureHTTP.Handler)(next)
+		nextHTTPS := echo.WrapMiddleware(secureHTTPS.Handler)(next)
+		return func(c echo.Context) error {
+			if c.Request().TLS != nil {
+				return nextHTTPS(c)
+			}
+			return nextHTTP(c)
+		}
+	})
 	e.Use(echo.WrapMiddleware(gmw.SetCORP("same-site")))
 	e.Use(echo.WrapMiddleware(gmw.SetCOEP("require-corp")))
 	return nil
 }
 
+// redirectsToHTTPS checks whether the HTTP server should only redirect requests to the HTTPS
+// server.
+func (s *Server) redirectsToHTTPS() bool {
+	return s.Globals.Certs.Enabled() && s.Globals.Config.HTTPS.Redirect
+}
+
+// redirectToHTTPS is middleware which redirects requests received over HTTP to the same URL on the
+// HTTPS server. Requests which a trusted reverse-proxy received over HTTPS aren't redirected; other
+// requests from trusted reverse-proxies are redirected to the default HTTPS port on the
+// reverse-proxy's host. The trust-onboarding page (and the assets it needs) aren't redirected, so
+// that browsers which don't trust the HTTPS server yet can still download its certificate
+// authority.
+func (s *Server) redirectToHTTPS(next echo.HandlerFunc) echo.HandlerFunc {
+	basePath := s.Globals.Config.HTTP.BasePath
+	unredirected := []string{
+		basePath + trust.URLPrefix, basePath + assets.AppURLPrefix,
+		basePath + assets.StaticURLPrefix, basePath + assets.FontsURLPrefix,
+		basePath + "/favicon.ico",
+	}
+	return func(c echo.Context) error {
+		r := c.Request()
+		for _, prefix := range unredirected {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return next(c)
+			}
+		}
+		forwarded := s.Globals.Config.HTTP.TrustsProxy(r.RemoteAddr)
+		a, err := accesspath.FromRequest(r, "", "", forwarded)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if a.Scheme == "https" {
+			return next(c)
+		}
+		a = a.WithScheme("https", s.Globals.Config.HTTPS.URLPort(forwarded))
+		u := url.URL{Scheme: a.Scheme, Host: a.Host(), Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		return c.Redirect(http.StatusPermanentRedirect, u.String())
+	}
+}
+
 func (s *Server) Register(e *echo.Echo) error {
+	basePath := s.Globals.Config.HTTP.BasePath
 	e.Use(middleware.Recover())
+	s.configureProxies(e)
+	if s.Metrics != nil {
+		e.Use(s.Metrics.Middleware())
+		if s.Globals.Config.Metrics.Port == 0 {
+			e.GET(basePath+metrics.URLPath, echo.WrapHandler(s.Metrics.Handler()))
+		}
+	}
+	if s.redirectsToHTTPS() {
+		e.Pre(s.redirectToHTTPS)
+	}
 	s.configureLogging(e)
 	if err := s.configureHeaders(e); err != nil {
 		return errors.Wrap(err, "couldn't configure http headers")
@@ -159,17 +319,40 @@ func (s *Server) Register(e *echo.Echo) error {
 	// Compression Middleware
 	e.Use(middleware.Decompress())
 	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Skipper: func(c echo.Context) bool {
+			// Server-sent events should be flushed to the client immediately
+			return strings.HasPrefix(c.Path(), basePath+streams.URLPrefix)
+		},
 		Level: s.Globals.Config.HTTP.GzipLevel,
 	}))
 
 	// Other Middleware
-	e.Pre(middleware.RemoveTrailingSlash())
+	e.Pre(middleware.RemoveTrailingSlashWithConfig(middleware.TrailingSlashConfig{
+		Skipper: func(c echo.Context) bool {
+			// The home page is served at the base path with a trailing slash, so that the home page
+			// is within the scope of the web app manifest
+			return basePath != "" && c.Request().URL.Path == basePath+"/"
+		},
+	}))
 	e.Use(gmw.RequireContentTypes(echo.MIMEApplicationForm))
-	// TODO: enable Prometheus and rate-limiting
+	s.configureRateLimiting(e)
 
 	// Handlers
-	e.HTTPErrorHandler = NewHTTPErrorHandler(s.Renderer, s.Embeds.TemplatesFS)
-	s.Handlers.Register(e, s.Embeds)
+	e.HTTPErrorHandler = NewHTTPErrorHandler(
+		s.Renderer, s.Embeds.TemplatesFS, s.Globals.Config.HTTP,
+	)
+	if basePath != "" {
+		e.GET(basePath, func(c echo.Context) error {
+			return c.Redirect(http.StatusMovedPermanently, basePath+"/")
+		})
+	}
+	s.Handlers.Register(e.Group(basePath), basePath, s.Globals.Base.TSBroker, s.Embeds)
+	// e.Shutdown calls e.TLSServer.Shutdown and then e.Server.Shutdown, each of which waits for all
+	// requests to finish - including requests for long-lived event streams, which would otherwise
+	// only finish when the browser disconnects - so we need to end those event streams when either
+	// server starts shutting down (e.TLSServer is shut down first, even if HTTPS is disabled):
+	e.TLSServer.RegisterOnShutdown(s.Handlers.CloseStreams)
+	e.Server.RegisterOnShutdown(s.Handlers.CloseStreams)
 
 	return nil
 }
@@ -178,34 +361,117 @@ func (s *Server) Register(e *echo.Echo) error {
 
 func (s *Server) Run(e *echo.Echo) error {
 	s.Globals.Base.Logger.Info("starting device-portal server")
+	if s.Globals.Certs.Enabled() {
+		// We load the certificate now so that any problems with it are reported immediately, rather
+		// than on the first request
+		if _, err := s.Globals.Certs.GetCertificate(nil); err != nil {
+			return errors.Wrap(err, "couldn't load certificate for https server")
+		}
+	}
 
 	// The echo http server can't be canceled by context cancelation, so the API shouldn't promise to
 	// stop blocking execution on context cancelation - so we use the background context here. The
 	// http server should instead be stopped gracefully by calling the Shutdown method, or forcefully
-	// by calling the Close method.
-	eg, _ := errgroup.WithContext(context.Background())
+	// by calling the Close method; background workers are then stopped once the http server stops.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eg, egctx := errgroup.WithContext(ctx)
+	if s.Globals.Certs.Enabled() {
+		// We configure the https server before starting any goroutines, so that its configuration
+		// doesn't race with Shutdown
+		e.TLSServer.Addr = fmt.Sprintf(":%d", s.Globals.Config.HTTPS.Port)
+		e.TLSServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.Globals.Certs.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+	// If either server fails (e.g. because its port is in use), the other server is closed so that
+	// Run returns the error, rather than continuing to serve requests without background workers
 	eg.Go(func() error {
+		defer cancel()
 		address := fmt.Sprintf(":%d", s.Globals.Config.HTTP.Port)
 		s.Globals.Base.Logger.Infof("starting http server on %s", address)
-		return e.Start(address)
+		if err := e.Start(address); err != http.ErrServerClosed {
+			_ = e.TLSServer.Close()
+			return errors.Wrap(err, "http server encountered error")
+		}
+		return nil
 	})
-	if err := eg.Wait(); err != http.ErrServerClosed {
-		return errors.Wrap(err, "http server encountered error")
+	if s.Globals.Certs.Enabled() {
+		eg.Go(func() error {
+			defer cancel()
+			s.Globals.Base.Logger.Infof("starting https server on %s", e.TLSServer.Addr)
+			if err := e.StartServer(e.TLSServer); err != http.ErrServerClosed {
+				_ = e.Server.Close()
+				return errors.Wrap(err, "https server encountered error")
+			}
+			return nil
+		})
 	}
-	return nil
+	if s.metricsServer != nil {
+		eg.Go(func() error {
+			s.Globals.Base.Logger.Infof("starting metrics server on %s", s.metricsServer.Addr)
+			if err := s.metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				// Failure to serve metrics shouldn't take down the server
+				s.Globals.Base.Logger.Error(errors.Wrap(err, "metrics server encountered error"))
+			}
+			return nil
+		})
+	}
+	eg.Go(func() error {
+		return errors.Wrap(
+			handling.Except(s.Globals.Base.TSBroker.Serve(egctx), context.Canceled),
+			"turbo streams broker encountered error",
+		)
+	})
+	eg.Go(func() error {
+		// Failure to watch for template changes shouldn't take down the server
+		if err := s.Globals.Base.Templates.Watch(egctx); err != nil {
+			s.Globals.Base.Logger.Error(errors.Wrap(err, "couldn't watch for template changes"))
+		}
+		return nil
+	})
+	eg.Go(func() error {
+		// Failure to watch for app registry changes shouldn't take down the server
+		if err := s.Globals.Apps.Watch(egctx); err != nil {
+			s.Globals.Base.Logger.Error(errors.Wrap(err, "couldn't watch for app registry changes"))
+		}
+		return nil
+	})
+	eg.Go(func() error {
+		return errors.Wrap(s.Globals.Health.Run(egctx), "app health prober encountered error")
+	})
+	eg.Go(func() error {
+		// Failure to advertise over mDNS (e.g. because multicast is unavailable) shouldn't take down
+		// the server
+		if err := s.Globals.MDNS.Serve(egctx); err != nil {
+			s.Globals.Base.Logger.Error(errors.Wrap(err, "couldn't advertise services over mDNS"))
+		}
+		return nil
+	})
+	return eg.Wait()
 }
 
 func (s *Server) Shutdown(ctx context.Context, e *echo.Echo) (err error) {
-	// FIXME: e.Shutdown calls e.Server.Shutdown, which doesn't wait for WebSocket connections. When
-	// starting Echo, we need to call e.Server.RegisterOnShutdown with a function to gracefully close
-	// WebSocket connections!
 	if errEcho := e.Shutdown(ctx); errEcho != nil {
 		s.Globals.Base.Logger.Error(errors.Wrap(errEcho, "couldn't shut down http server"))
 		err = errEcho
 	}
+	if s.metricsServer != nil {
+		if errMetrics := s.metricsServer.Shutdown(ctx); errMetrics != nil {
+			s.Globals.Base.Logger.Error(errors.Wrap(errMetrics, "couldn't shut down metrics server"))
+			err = errMetrics
+		}
+	}
 	return err
 }
 
 func (s *Server) Close(e *echo.Echo) error {
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Close(); err != nil {
+			return errors.Wrap(err, "metrics server encountered error when closing its listener")
+		}
+	}
 	return errors.Wrap(e.Close(), "http server encountered error when closing an underlying listener")
 }
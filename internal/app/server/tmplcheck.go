@@ -0,0 +1,327 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/httperr"
+
+	"github.com/openUC2/device-portal/internal/app/server/accesspath"
+	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/routes/home"
+	"github.com/openUC2/device-portal/internal/app/server/routes/machines"
+	"github.com/openUC2/device-portal/internal/app/server/routes/trust"
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/certs"
+	"github.com/openUC2/device-portal/internal/clients/health"
+	"github.com/openUC2/device-portal/internal/clients/mdns"
+	"github.com/openUC2/device-portal/internal/overlayfs"
+	"github.com/openUC2/device-portal/web"
+)
+
+// A TemplateProblem is a problem found in a template by [CheckTemplates].
+type TemplateProblem struct {
+	// File is the path of the template's file, which is in the first checked directory which has the
+	// template, unless the problem was found in a built-in template.
+	File string
+	// Line is the line of the template where the problem was found, or zero if it's unknown.
+	Line        int
+	Description string
+}
+
+func (p TemplateProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Description)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Description)
+}
+
+// TemplatesCheck is the result of [CheckTemplates].
+type TemplatesCheck struct {
+	// Checked are the names of the templates which were parsed.
+	Checked []string
+	// Unexecuted are the names of page templates which were parsed but not executed, since there's
+	// no sample data for them (e.g. because no route renders them).
+	Unexecuted []string
+	Problems   []TemplateProblem
+}
+
+// hiddenTemplateProblem describes a template which the server requires, but which is hidden.
+const hiddenTemplateProblem = "template is required by the server, but it's hidden by a whiteout"
+
+// CheckTemplates overlays the templates in the directories (in priority order) over the built-in
+// templates, as the server would with the templates paths. It then parses every template, and it
+// executes every page template and partial template for which there's sample data.
+func CheckTemplates(dirs []string) (TemplatesCheck, error) {
+	if err := checkDirs(dirs); err != nil {
+		return TemplatesCheck{}, err
+	}
+	return checkTemplates(dirs, overlayfs.DirLayers(dirs))
+}
+
+// validateTemplates checks templates loaded from the templates paths (with a layer for each path)
+// in the same way as [CheckTemplates], so that invalid templates don't replace the templates used
+// by the server.
+func validateTemplates(paths []string, layers []fs.FS) error {
+	result, err := checkTemplates(paths, layers)
+	if err != nil {
+		return err
+	}
+	if len(result.Problems) == 0 {
+		return nil
+	}
+	problems := make([]string, 0, len(result.Problems))
+	for _, problem := range result.Problems {
+		problems = append(problems, problem.String())
+	}
+	return errors.Errorf(
+		"found %d problems in templates: %s", len(problems), strings.Join(problems, "; "),
+	)
+}
+
+// checkTemplates checks the templates in the layers (which are from the directories) overlaid over
+// the built-in templates.
+func checkTemplates(dirs []string, layers []fs.FS) (result TemplatesCheck, err error) {
+	embeds := web.NewEmbeds()
+	embeds.TemplatesFS = overlayfs.New(append(slices.Clone(layers), embeds.TemplatesFS)...)
+	const basePath = ""
+	funcs := templateFuncs(basePath, sampleBranding, embeds)
+	problemFile := func(name string) string {
+		for i, dir := range dirs {
+			if _, err := fs.Stat(layers[i], name); err == nil {
+				return filepath.Join(dir, filepath.FromSlash(name))
+			}
+		}
+		return "(built-in) " + name
+	}
+	addProblem := func(name string, err error) {
+		if d, ok := describeTemplateError(err); ok {
+			result.Problems = append(result.Problems, TemplateProblem{
+				File: problemFile(d.Name), Line: d.Line, Description: d.Description,
+			})
+			return
+		}
+		result.Problems = append(result.Problems, TemplateProblem{
+			File: problemFile(name), Description: err.Error(),
+		})
+	}
+
+	// Parse each template on its own, so that all syntax errors are reported
+	if err = fs.WalkDir(embeds.TemplatesFS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(name, ".tmpl") {
+			result.Checked = append(result.Checked, name)
+		}
+		return err
+	}); err != nil {
+		return TemplatesCheck{}, errors.Wrap(err, "couldn't list templates")
+	}
+	samples := newTemplateSamples(basePath)
+	for _, name := range slices.Sorted(maps.Keys(samples)) {
+		// The server requires every template it renders, so it won't start if any are hidden
+		if !slices.Contains(result.Checked, name) {
+			result.Problems = append(result.Problems, TemplateProblem{
+				File:        problemFile(name),
+				Description: hiddenTemplateProblem,
+			})
+		}
+	}
+	for _, name := range result.Checked {
+		raw, err := fs.ReadFile(embeds.TemplatesFS, name)
+		if err != nil {
+			return TemplatesCheck{}, errors.Wrapf(err, "couldn't read template %s", name)
+		}
+		tmpl := template.New(name)
+		for _, f := range funcs {
+			tmpl = tmpl.Funcs(f)
+		}
+		if _, err = tmpl.Parse(string(raw)); err != nil {
+			addProblem(name, err)
+		}
+	}
+	if len(result.Problems) > 0 {
+		return result, nil
+	}
+
+	// Execute templates with sample data, which also reports missing definitions
+	tr, err := godest.NewTemplateRenderer(embeds, web.NewInlines(), funcs...)
+	if err != nil {
+		addProblem("", err)
+		return result, nil
+	}
+	for _, name := range result.Checked {
+		variants, ok := samples[name]
+		switch {
+		case strings.HasSuffix(name, ".layout.tmpl"):
+			continue // layouts are executed by pages
+		case strings.HasSuffix(name, ".partial.tmpl"):
+			for _, data := range variants {
+				if err = tr.WritePartial(&strings.Builder{}, name, data); err != nil {
+					addProblem(name, err)
+					break
+				}
+			}
+			continue
+		case !ok:
+			result.Unexecuted = append(result.Unexecuted, name)
+			continue
+		}
+		for _, data := range variants {
+			r := httptest.NewRequest(http.MethodGet, "http://"+sampleHostname+basePath+"/", nil)
+			if err = tr.Page(
+				httptest.NewRecorder(), r, http.StatusOK, name, data, struct{}{},
+			); err != nil {
+				addProblem(name, err)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Sample data
+
+var sampleBranding = conf.BrandingConfig{
+	Name:            conf.DefaultBrandingName,
+	ShortName:       conf.DefaultBrandingName,
+	ThemeColor:      conf.DefaultBrandingThemeColor,
+	BackgroundColor: conf.DefaultBrandingBackgroundColor,
+}
+
+const (
+	sampleMachineName = "metal-slope-23501"
+	sampleHostname    = accesspath.MDNSHostnamePrefix + sampleMachineName + "." +
+		accesspath.MDNSDomain
+)
+
+// newTemplateSamples returns variants of sample data for each template which is rendered by the
+// server, keyed by template name.
+func newTemplateSamples(basePath string) map[string][]any {
+	return map[string][]any{
+		"app/app.webmanifest.tmpl": {struct{}{}},
+		"app/httperr.page.tmpl": {
+			ErrorData{
+				Code:  http.StatusNotFound,
+				Error: httperr.Describe(http.StatusNotFound),
+			},
+			ErrorData{
+				Code:      http.StatusInternalServerError,
+				Error:     httperr.Describe(http.StatusInternalServerError),
+				Messages:  []string{"something went wrong"},
+				RequestID: "SAMPLEREQUESTID",
+				Template: &TemplateErrorData{
+					Name: "home/index.page.tmpl", Line: 1, Description: "something is wrong",
+				},
+			},
+		},
+		"home/index.page.tmpl":       newHomeSamples(basePath),
+		"home/health.partial.tmpl":   {map[string]any{"ID": "sample", "Status": health.StatusUp}},
+		"machines/index.page.tmpl":   newMachinesSamples(),
+		"trust/index.page.tmpl":      newTrustSamples(),
+		"trust/ca.mobileconfig.tmpl": {newMobileconfigSample()},
+	}
+}
+
+func newHomeSamples(basePath string) (samples []any) {
+	registry := apps.Registry{Apps: []apps.App{
+		{
+			ID: "browser", Name: "Sample app", Description: "A sample app", URL: "/sample/",
+			Icon: "/sample/icon.png", Category: apps.CategoryBrowserApp, Audience: apps.AudienceBasic,
+			Health: &apps.HealthCheck{HTTP: "http://localhost:8080"},
+		},
+		{
+			ID: "api", Name: "Sample API", Note: "A sample note", Port: 8080,
+			Category: apps.CategoryNetworkAPI, Audience: apps.AudienceAdvanced, Group: "Sample group",
+		},
+		{
+			ID: "infra", Name: "Sample service", URL: "https://example.com",
+			Category: apps.CategorySystemInfra, Audience: apps.AudienceAdvanced,
+		},
+	}}
+	hosts := []string{
+		sampleHostname,
+		sampleMachineName + "." + accesspath.HotspotDomain,
+		accesspath.GenericMDNSHostname + "." + accesspath.MDNSDomain,
+		"192.168.1.10:3001",
+		"localhost",
+	}
+	// The machine name is empty if it couldn't be determined, so there are no machine-specific
+	// alternatives
+	for _, machineName := range []string{sampleMachineName, ""} {
+		for _, host := range hosts {
+			r := httptest.NewRequest(http.MethodGet, "http://"+host+basePath+"/", nil)
+			access, err := accesspath.FromRequest(r, basePath, machineName, false)
+			if err != nil {
+				continue
+			}
+			samples = append(samples, home.HomeViewData{
+				Access: access, MachineName: machineName, Apps: registry,
+				Health: map[string]health.Status{"browser": health.StatusDegraded},
+			})
+		}
+	}
+	return samples
+}
+
+func newMachinesSamples() []any {
+	return []any{
+		machines.MachinesViewData{MachineName: sampleMachineName},
+		machines.MachinesViewData{
+			MachineName: sampleMachineName,
+			Enabled:     true,
+			Machines: []mdns.Machine{{
+				Instance: "Machine ocean-fern-10422", Name: "ocean-fern-10422", Version: "v0.0.0",
+				Host: "openuc2-ocean-fern-10422.local", Port: 80, Path: "/",
+				Addresses: []string{"192.168.1.11"},
+			}},
+		},
+	}
+}
+
+func newCASample() trust.CAViewData {
+	return trust.CAViewData{
+		Name:     "openUC2 device portal CA for " + sampleMachineName,
+		NotAfter: time.Now(),
+		Hostnames: []string{
+			"localhost", "openuc2-" + sampleMachineName + ".local", "openuc2.local",
+			sampleMachineName + ".uc2",
+		},
+		SHA256Fingerprint: strings.Repeat("00:", 31) + "00",
+		SHA1Fingerprint:   strings.Repeat("00:", 19) + "00",
+		DERBase64:         "AA==",
+		ProfileUUID:       "00000000-0000-8000-8000-000000000000",
+		PayloadUUID:       "00000000-0000-8000-8000-000000000001",
+	}
+}
+
+func newMobileconfigSample() trust.TrustViewData {
+	ca := newCASample()
+	return trust.TrustViewData{MachineName: sampleMachineName, Mode: certs.ModeLocalCA, CA: &ca}
+}
+
+func newTrustSamples() []any {
+	ca := newCASample()
+	httpsURL := "https://" + sampleHostname + ":3443/"
+	return []any{
+		trust.TrustViewData{MachineName: sampleMachineName, Mode: certs.ModeNone},
+		trust.TrustViewData{
+			MachineName: sampleMachineName, Mode: certs.ModeSelfSigned, HTTPSURL: httpsURL,
+		},
+		trust.TrustViewData{
+			MachineName: sampleMachineName, Mode: certs.ModeLocalCA, CA: &ca, HTTPSURL: httpsURL,
+		},
+		trust.TrustViewData{
+			MachineName: sampleMachineName, Mode: certs.ModeLocalCA, CA: &ca, Secure: true,
+			HTTPSURL: httpsURL,
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/app/server/routes/home"
+	"github.com/openUC2/device-portal/internal/overlayfs"
+	"github.com/openUC2/device-portal/web"
+)
+
+func TestCheckBuiltinTemplates(t *testing.T) {
+	t.Parallel()
+	result, err := CheckTemplates(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, problem := range result.Problems {
+		t.Errorf("unexpected problem: %s", problem)
+	}
+}
+
+func TestCheckHiddenTemplates(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		layer    fstest.MapFS
+		problems []TemplateProblem
+	}{
+		{name: "no whiteouts", layer: fstest.MapFS{}},
+		{
+			name:  "missing template",
+			layer: fstest.MapFS{"home/" + overlayfs.WhiteoutPrefix + "missing.page.tmpl": {}},
+		},
+		{
+			name:  "required template",
+			layer: fstest.MapFS{"home/" + overlayfs.WhiteoutPrefix + "index.page.tmpl": {}},
+			problems: []TemplateProblem{
+				{File: "(built-in) home/index.page.tmpl", Description: hiddenTemplateProblem},
+			},
+		},
+		{
+			name:  "directory with required templates",
+			layer: fstest.MapFS{"machines/" + overlayfs.OpaqueMarker: {}},
+			problems: []TemplateProblem{
+				{File: "(built-in) machines/index.page.tmpl", Description: hiddenTemplateProblem},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			result, err := checkTemplates([]string{"custom"}, []fs.FS{tc.layer})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(result.Problems, tc.problems) {
+				t.Errorf("got problems %+v, expected %+v", result.Problems, tc.problems)
+			}
+		})
+	}
+}
+
+func TestHomeWithoutMachineName(t *testing.T) {
+	t.Parallel()
+	embeds := web.NewEmbeds()
+	tr, err := godest.NewTemplateRenderer(
+		embeds, web.NewInlines(), templateFuncs("", sampleBranding, embeds)...,
+	)
+	if err != nil {
+		t.Fatalf("couldn't make template renderer: %s", err)
+	}
+	for _, data := range newHomeSamples("") {
+		vd, ok := data.(home.HomeViewData)
+		if !ok || vd.MachineName != "" {
+			continue
+		}
+		t.Run(vd.Access.Host(), func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, vd.Access.URL("/"), nil)
+			w := httptest.NewRecorder()
+			if err := tr.Page(w, r, http.StatusOK, "home/index.page.tmpl", vd, struct{}{}); err != nil {
+				t.Fatalf("couldn't render page: %s", err)
+			}
+			// Machine-specific alternatives don't exist without a machine name
+			if body := w.Body.String(); strings.Contains(body, `href=""`) {
+				t.Errorf("page has a link without a URL")
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	htmltemplate "html/template"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateErrorData describes a problem with a template which prevented a page from being rendered,
+// e.g. in a custom template from the templates directory.
+type TemplateErrorData struct {
+	// Name is the name of the template, which is its path in the templates filesystem.
+	Name string
+	// Line is the line of the template where the problem was found, or zero if it's unknown.
+	Line        int
+	Description string
+}
+
+// textTemplateErrorPattern matches the messages of parsing and execution errors from text/template
+// (which html/template uses), e.g. "template: home/index.page.tmpl:12:5: executing ...".
+var textTemplateErrorPattern = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::\d+)?: (.*)`)
+
+// describeTemplateError determines whether the error was caused by a problem with a template, and
+// if so, which template and line it was in.
+func describeTemplateError(err error) (d TemplateErrorData, ok bool) {
+	if err == nil {
+		return TemplateErrorData{}, false
+	}
+	var htmlErr *htmltemplate.Error
+	if errors.As(err, &htmlErr) {
+		return TemplateErrorData{
+			Name: htmlErr.Name, Line: htmlErr.Line, Description: htmlErr.Description,
+		}, true
+	}
+
+	matches := textTemplateErrorPattern.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return TemplateErrorData{}, false
+	}
+	d.Name = matches[1]
+	d.Line, _ = strconv.Atoi(matches[2]) // the pattern only matches digits
+	d.Description = matches[3]
+	return d, true
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/openUC2/device-portal/internal/overlayfs"
+	"github.com/openUC2/device-portal/web"
+)
+
+// TemplatesExport is the result of [ExportTemplates].
+type TemplatesExport struct {
+	// Written are the paths of the templates which were written.
+	Written []string
+	// Skipped are the paths of the templates which weren't written, since files already existed at
+	// those paths.
+	Skipped []string
+}
+
+// ExportTemplates writes the built-in templates to the directory, e.g. as a starting point for
+// custom templates. If paths are specified, only the templates at those paths (or in those
+// directories) are written. Existing files are only replaced if overwrite is true.
+func ExportTemplates(
+	dir string, paths []string, overwrite bool,
+) (result TemplatesExport, err error) {
+	templatesFS := web.NewEmbeds().TemplatesFS
+	selected := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleaned := path.Clean(strings.Trim(filepath.ToSlash(p), "/"))
+		if _, err = fs.Stat(templatesFS, cleaned); err != nil {
+			return TemplatesExport{}, errors.Wrapf(err, "couldn't find built-in template %s", p)
+		}
+		selected = append(selected, cleaned)
+	}
+
+	err = fs.WalkDir(templatesFS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !selectedPath(name, selected) {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err = os.Stat(target); err == nil && !overwrite {
+			result.Skipped = append(result.Skipped, name)
+			return nil
+		}
+		contents, err := fs.ReadFile(templatesFS, name)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read built-in template %s", name)
+		}
+		const (
+			dirPerm  = 0o755
+			filePerm = 0o644
+		)
+		if err = os.MkdirAll(filepath.Dir(target), dirPerm); err != nil {
+			return errors.Wrapf(err, "couldn't make directory for %s", target)
+		}
+		if err = os.WriteFile(target, contents, filePerm); err != nil {
+			return errors.Wrapf(err, "couldn't write %s", target)
+		}
+		result.Written = append(result.Written, name)
+		return nil
+	})
+	return result, errors.Wrap(err, "couldn't export built-in templates")
+}
+
+// selectedPath checks whether the path is one of the selected paths or is in one of them, where
+// all paths are selected if none are specified.
+func selectedPath(name string, selected []string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	for _, s := range selected {
+		if s == "." || name == s || strings.HasPrefix(name, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareTemplates describes which templates in the directories add to, shadow, or are identical
+// to the built-in templates, and which built-in templates are inherited, when the directories are
+// used as the templates paths (in priority order). The layer of each file is the index of its
+// directory, or len(dirs) for built-in templates.
+func CompareTemplates(dirs []string) ([]overlayfs.LayeredFile, error) {
+	overlay, err := newTemplatesOverlay(dirs, web.NewEmbeds().TemplatesFS)
+	if err != nil {
+		return nil, err
+	}
+	return overlay.Compare()
+}
+
+// newTemplatesOverlay stacks the directories (in priority order) over the built-in templates.
+func newTemplatesOverlay(dirs []string, builtin fs.FS) (*overlayfs.FS, error) {
+	if err := checkDirs(dirs); err != nil {
+		return nil, err
+	}
+	return overlayfs.New(append(overlayfs.DirLayers(dirs), builtin)...), nil
+}
+
+// checkDirs checks that the templates directories exist.
+func checkDirs(dirs []string) error {
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			return errors.Wrapf(err, "couldn't open templates directory %s", dir)
+		}
+	}
+	return nil
+}
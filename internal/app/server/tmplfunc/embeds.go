@@ -9,9 +9,13 @@ type HashedNamers struct {
 	StaticHashed func(filename string) string
 }
 
-func NewHashedNamers(appURLPrefix, staticURLPrefix string, embeds godest.Embeds) HashedNamers {
+// NewHashedNamers makes namers for the URLs of hashed assets, where the URL prefixes are relative
+// to the base path which all routes are served under.
+func NewHashedNamers(
+	basePath, appURLPrefix, staticURLPrefix string, embeds godest.Embeds,
+) HashedNamers {
 	return HashedNamers{
-		AppHashed:    embeds.GetAppHashedNamer(appURLPrefix),
-		StaticHashed: embeds.GetStaticHashedNamer(staticURLPrefix),
+		AppHashed:    embeds.GetAppHashedNamer(basePath + appURLPrefix),
+		StaticHashed: embeds.GetStaticHashedNamer(basePath + staticURLPrefix),
 	}
 }
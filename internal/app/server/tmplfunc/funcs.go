@@ -2,14 +2,42 @@
 package tmplfunc
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/url"
+
+	"github.com/openUC2/device-portal/internal/app/server/conf"
 )
 
-func FuncMap(h HashedNamers) template.FuncMap {
+// FuncMap returns the extension functions for templates. basePath is the path prefix which all
+// routes are served under (without a trailing slash), which templates must prepend to the absolute
+// paths of links, e.g. {{basePath}}/machines. branding is returned by the branding function, e.g.
+// for {{branding.Name}}.
+func FuncMap(basePath string, branding conf.BrandingConfig, h HashedNamers) template.FuncMap {
 	return template.FuncMap{
 		"queryEscape":  url.QueryEscape,
 		"appHashed":    h.AppHashed,
 		"staticHashed": h.StaticHashed,
+		"basePath": func() string {
+			return basePath
+		},
+		"branding": func() conf.BrandingConfig {
+			return branding
+		},
+		// jsonString is needed for strings in JSON documents, since html/template escapes quotes as
+		// HTML entities
+		"jsonString": jsonString,
+		// xmlDeclaration is needed for XML documents, since html/template escapes the declaration
+		// when it's written literally in a template
+		"xmlDeclaration": func() template.HTML {
+			return `<?xml version="1.0" encoding="UTF-8"?>`
+		},
 	}
 }
+
+// jsonString quotes the string as a JSON string. Its result can't break out of the string even in
+// HTML, since the JSON encoder escapes HTML special characters.
+func jsonString(s string) template.HTML {
+	quoted, _ := json.Marshal(s) // strings can always be marshaled
+	return template.HTML(quoted) //nolint:gosec // the JSON encoder escapes HTML special characters
+}
@@ -0,0 +1,36 @@
+package apps
+
+import (
+	"github.com/sargassum-world/godest/clientcache"
+)
+
+type Cache struct {
+	Cache clientcache.Cache
+}
+
+// /apps/registry
+
+func keyRegistry() string {
+	return "/apps/registry"
+}
+
+func (c *Cache) SetRegistry(registry Registry, costWeight float32) error {
+	key := keyRegistry()
+	return c.Cache.SetEntry(key, registry, costWeight, -1)
+}
+
+func (c *Cache) UnsetRegistry() {
+	key := keyRegistry()
+	c.Cache.UnsetEntry(key)
+}
+
+func (c *Cache) GetRegistry() (Registry, bool, error) {
+	key := keyRegistry()
+	var value Registry
+	keyExists, valueExists, err := c.Cache.GetEntry(key, &value)
+	if !keyExists || !valueExists || err != nil {
+		return Registry{}, keyExists, err
+	}
+
+	return value, true, nil
+}
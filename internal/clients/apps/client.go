@@ -0,0 +1,119 @@
+// Package apps loads the registry of apps provided by the machine from a directory of app
+// registration files, so that the device portal can list those apps for users
+package apps
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/clientcache"
+	"github.com/sargassum-world/godest/pubsub"
+)
+
+type Client struct {
+	Config Config
+	Logger godest.Logger
+	Cache  *Cache
+
+	hub *pubsub.Hub[Registry]
+}
+
+func NewClient(c Config, cache clientcache.Cache, l godest.Logger) *Client {
+	return &Client{
+		Config: c,
+		Logger: l,
+		Cache: &Cache{
+			Cache: cache,
+		},
+		hub: pubsub.NewHub[Registry](nil, l),
+	}
+}
+
+func (c *Client) GetRegistry() (Registry, error) {
+	if registry, cacheHit := c.getRegistryFromCache(); cacheHit {
+		return registry, nil
+	}
+	return c.getRegistryFromFiles()
+}
+
+// Subscribe adds a subscription to changes of the app registry detected by [Client.Watch]. While
+// the subscription is active, the receive callback function will be called with the updated
+// registry after each change. The subscription is active until the callback function returns an
+// error or the context is done; the returned channel is closed when the subscription becomes
+// inactive.
+func (c *Client) Subscribe(
+	ctx context.Context, receive func(registry Registry) error,
+) (removed <-chan struct{}) {
+	return c.hub.Subscribe(ctx, keyRegistry(), receive)
+}
+
+func (c *Client) getRegistryFromCache() (Registry, bool) {
+	registry, cacheHit, err := c.Cache.GetRegistry()
+	if err != nil {
+		// Log the error but return as a cache miss so we can manually load the registry
+		c.Logger.Error(errors.Wrap(err, "couldn't get the cache entry for the app registry"))
+		return Registry{}, false // treat an unparseable cache entry like a cache miss
+	}
+	return registry, cacheHit
+}
+
+func (c *Client) getRegistryFromFiles() (Registry, error) {
+	registry, err := c.loadRegistry()
+	if err != nil {
+		return Registry{}, err
+	}
+	if err := c.Cache.SetRegistry(registry, c.Config.CacheCost); err != nil {
+		return Registry{}, errors.Wrap(err, "couldn't cache app registry")
+	}
+	c.Logger.Infof("loaded %d app registrations from %s", len(registry.Apps), c.Config.Path)
+	return registry, nil
+}
+
+func (c *Client) loadRegistry() (registry Registry, err error) {
+	if c.Config.Path == "" {
+		return Registry{}, nil
+	}
+	entries, err := os.ReadDir(c.Config.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.Logger.Warnf("app registrations directory %s doesn't exist", c.Config.Path)
+			return Registry{}, nil
+		}
+		return Registry{}, errors.Wrapf(
+			err, "couldn't list app registrations directory %s", c.Config.Path,
+		)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isRegistrationFile(entry.Name()) {
+			continue
+		}
+		filePath := filepath.Join(c.Config.Path, entry.Name())
+		raw, err := os.ReadFile(filepath.Clean(filePath))
+		if err != nil {
+			// A single unreadable file shouldn't prevent other apps from being listed
+			c.Logger.Error(errors.Wrapf(err, "couldn't read app registration file %s", filePath))
+			continue
+		}
+		app, err := parseApp(entry.Name(), raw)
+		if err != nil {
+			// A single malformed file shouldn't prevent other apps from being listed
+			c.Logger.Error(errors.Wrapf(err, "couldn't load app registration file %s", filePath))
+			continue
+		}
+		if _, ok := registry.Get(app.ID); ok {
+			c.Logger.Warnf(
+				"ignoring app registration file %s, since app %s was already registered",
+				filePath, app.ID,
+			)
+			continue
+		}
+		registry.Apps = append(registry.Apps, app)
+	}
+	registry.sort()
+	return registry, nil
+}
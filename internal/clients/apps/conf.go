@@ -0,0 +1,66 @@
+package apps
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const envPrefix = "APPS_"
+
+// WatchMode determines how the app registrations directory is watched for changes.
+type WatchMode string
+
+const (
+	// WatchModeNotify watches the directory with filesystem notifications (e.g. inotify on Linux),
+	// falling back to polling if filesystem notifications are unavailable.
+	WatchModeNotify WatchMode = "notify"
+	// WatchModePoll periodically re-scans the directory.
+	WatchModePoll WatchMode = "poll"
+	// WatchModeNone disables watching, so that changes are only loaded after a restart.
+	WatchModeNone WatchMode = "none"
+)
+
+type Config struct {
+	Path string
+
+	WatchMode    WatchMode
+	PollInterval time.Duration
+
+	CacheCost float32
+}
+
+// Default values of apps settings.
+const (
+	// DefaultPath is a directory path specific to ImSwitch OS.
+	DefaultPath         = "/etc/device-portal/apps"
+	DefaultWatchMode    = WatchModeNotify
+	DefaultPollInterval = "5s"
+	DefaultCacheCost    = 1.0
+)
+
+func GetConfig() (c Config, err error) {
+	c.Path = env.GetString(envPrefix+"PATH", DefaultPath)
+
+	c.WatchMode = WatchMode(env.GetString(envPrefix+"WATCH", string(DefaultWatchMode)))
+	switch c.WatchMode {
+	default:
+		return Config{}, errors.Errorf(
+			"unknown watch mode %s (must be one of: %s, %s, %s)",
+			c.WatchMode, WatchModeNotify, WatchModePoll, WatchModeNone,
+		)
+	case WatchModeNotify, WatchModePoll, WatchModeNone:
+	}
+
+	rawPollInterval := env.GetString(envPrefix+"POLLINTERVAL", DefaultPollInterval)
+	if c.PollInterval, err = time.ParseDuration(rawPollInterval); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make poll interval config")
+	}
+
+	c.CacheCost, err = env.GetFloat32(envPrefix+"CACHE_COST", DefaultCacheCost)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make cache cost config")
+	}
+	return c, nil
+}
@@ -0,0 +1,294 @@
+package apps
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Category
+
+// A Category describes what kind of service an app provides.
+type Category string
+
+const (
+	CategoryBrowserApp  Category = "browser-app"
+	CategoryNetworkAPI  Category = "network-api"
+	CategorySystemInfra Category = "system-infrastructure"
+	defaultCategory              = CategoryBrowserApp
+)
+
+func (c Category) Valid() bool {
+	switch c {
+	default:
+		return false
+	case CategoryBrowserApp, CategoryNetworkAPI, CategorySystemInfra:
+		return true
+	}
+}
+
+// Audience
+
+// An Audience describes which users an app is meant for.
+type Audience string
+
+const (
+	AudienceBasic    Audience = "basic"
+	AudienceAdvanced Audience = "advanced"
+	defaultAudience           = AudienceBasic
+)
+
+func (a Audience) Valid() bool {
+	switch a {
+	default:
+		return false
+	case AudienceBasic, AudienceAdvanced:
+		return true
+	}
+}
+
+// App
+
+// An App is a registration of a network service provided by the machine, such as a browser
+// application, a network API, or a system infrastructure component.
+type App struct {
+	// ID is the unique identifier of the app, determined from the name of its registration file.
+	ID string `json:"id" toml:"-" yaml:"-"`
+	// Name is the human-readable name of the app.
+	Name string `json:"name" toml:"name" yaml:"name"`
+	// Description is a short human-readable description of the app.
+	Description string `json:"description,omitempty" toml:"description" yaml:"description"`
+	// Note is an optional human-readable note to emphasize to users below the description.
+	Note string `json:"note,omitempty" toml:"note" yaml:"note"`
+	// URL is the path (e.g. /admin/cockpit/) or absolute URL of the app.
+	URL string `json:"url,omitempty" toml:"url" yaml:"url"`
+	// Port is an optional port which, if specified, causes URL to be resolved on the hostname used
+	// to access the device portal, but at the specified port.
+	Port int `json:"port,omitempty" toml:"port" yaml:"port"`
+	// Icon is an optional path or absolute URL of an image to show next to the app's name.
+	Icon string `json:"icon,omitempty" toml:"icon" yaml:"icon"`
+	// Category is the kind of service provided by the app.
+	Category Category `json:"category" toml:"category" yaml:"category"`
+	// Audience is the kind of user which the app is meant for.
+	Audience Audience `json:"audience" toml:"audience" yaml:"audience"`
+	// Group is an optional heading for grouping related apps within a category.
+	Group string `json:"group,omitempty" toml:"group" yaml:"group"`
+	// Order is an optional sort key for apps within a category; lower values are listed first.
+	Order int `json:"order,omitempty" toml:"order" yaml:"order"`
+	// Health is an optional check for probing whether the app's upstream service is running.
+	Health *HealthCheck `json:"health,omitempty" toml:"health" yaml:"health"`
+}
+
+// Href returns the link to the app, resolved relative to the provided hostname if the app
+// specifies a port.
+func (a App) Href(hostname string) string {
+	if a.Port == 0 || hostname == "" {
+		return a.URL
+	}
+	href := "//" + net.JoinHostPort(hostname, strconv.Itoa(a.Port))
+	if a.URL != "" && !strings.HasPrefix(a.URL, "/") {
+		href += "/"
+	}
+	return href + a.URL
+}
+
+func (a App) validate() error {
+	if a.Name == "" {
+		return errors.New("name is required")
+	}
+	if !a.Category.Valid() {
+		return errors.Errorf(
+			"unknown category %s (must be one of: %s, %s, %s)",
+			a.Category, CategoryBrowserApp, CategoryNetworkAPI, CategorySystemInfra,
+		)
+	}
+	if !a.Audience.Valid() {
+		return errors.Errorf(
+			"unknown audience %s (must be one of: %s, %s)", a.Audience, AudienceBasic, AudienceAdvanced,
+		)
+	}
+	const maxPort = 65535
+	if a.Port < 0 || a.Port > maxPort {
+		return errors.Errorf("port %d is out of range", a.Port)
+	}
+	if a.Health != nil {
+		if err := a.Health.validate(); err != nil {
+			return errors.Wrap(err, "invalid health check")
+		}
+	}
+	return nil
+}
+
+// HealthCheck
+
+// A HealthCheck describes how to probe whether an app's upstream service is running. Exactly one of
+// HTTP or TCP must be specified.
+type HealthCheck struct {
+	// HTTP is the URL of the upstream service to send a GET request to; the check succeeds if the
+	// response has a non-error status code.
+	HTTP string `json:"http,omitempty" toml:"http" yaml:"http"`
+	// TCP is the address (in host:port form) of the upstream service to open a TCP connection to;
+	// the check succeeds if the connection is established.
+	TCP string `json:"tcp,omitempty" toml:"tcp" yaml:"tcp"`
+	// Interval is an optional override of the default interval between checks.
+	Interval time.Duration `json:"interval,omitempty" toml:"interval" yaml:"interval"`
+	// Timeout is an optional override of the default timeout for each check.
+	Timeout time.Duration `json:"timeout,omitempty" toml:"timeout" yaml:"timeout"`
+}
+
+func (h HealthCheck) validate() error {
+	switch {
+	case h.HTTP == "" && h.TCP == "":
+		return errors.New("either http or tcp must be specified")
+	case h.HTTP != "" && h.TCP != "":
+		return errors.New("only one of http or tcp may be specified")
+	case h.HTTP != "":
+		u, err := url.Parse(h.HTTP)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't parse http url %s", h.HTTP)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("http url %s must have an http or https scheme", h.HTTP)
+		}
+	case h.TCP != "":
+		if _, _, err := net.SplitHostPort(h.TCP); err != nil {
+			return errors.Wrapf(err, "couldn't parse tcp address %s", h.TCP)
+		}
+	}
+	if h.Interval < 0 {
+		return errors.Errorf("interval %s must not be negative", h.Interval)
+	}
+	if h.Timeout < 0 {
+		return errors.Errorf("timeout %s must not be negative", h.Timeout)
+	}
+	return nil
+}
+
+// Registration files
+
+const (
+	extTOML = ".toml"
+	extYAML = ".yaml"
+	extYML  = ".yml"
+)
+
+// isRegistrationFile checks whether the filename should be loaded as an app registration file.
+func isRegistrationFile(filename string) bool {
+	if strings.HasPrefix(filename, ".") {
+		return false
+	}
+	switch path.Ext(filename) {
+	default:
+		return false
+	case extTOML, extYAML, extYML:
+		return true
+	}
+}
+
+// parseApp parses an app registration from the contents of a TOML or YAML file with the
+// specified filename.
+func parseApp(filename string, raw []byte) (a App, err error) {
+	ext := path.Ext(filename)
+	switch ext {
+	default:
+		return App{}, errors.Errorf("unknown file extension %s", ext)
+	case extTOML:
+		md, err := toml.Decode(string(raw), &a)
+		if err != nil {
+			return App{}, errors.Wrap(err, "couldn't parse TOML")
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return App{}, errors.Errorf("unknown key %s", undecoded[0])
+		}
+	case extYAML, extYML:
+		decoder := yaml.NewDecoder(strings.NewReader(string(raw)))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&a); err != nil {
+			return App{}, errors.Wrap(err, "couldn't parse YAML")
+		}
+	}
+
+	a.ID = strings.TrimSuffix(filename, ext)
+	if a.Category == "" {
+		a.Category = defaultCategory
+	}
+	if a.Audience == "" {
+		a.Audience = defaultAudience
+	}
+	if err = a.validate(); err != nil {
+		return App{}, errors.Wrap(err, "invalid app registration")
+	}
+	return a, nil
+}
+
+// Registry
+
+// A Registry is the set of all apps registered on the machine.
+type Registry struct {
+	Apps []App `json:"apps"`
+}
+
+// A Group is a list of apps sharing the same group heading.
+type Group struct {
+	Name string `json:"name,omitempty"`
+	Apps []App  `json:"apps"`
+}
+
+func (r *Registry) sort() {
+	slices.SortStableFunc(r.Apps, func(a, b App) int {
+		return cmp.Or(
+			cmp.Compare(a.Group, b.Group),
+			cmp.Compare(a.Order, b.Order),
+			cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+}
+
+// Get returns the app with the specified ID, if it exists.
+func (r Registry) Get(id string) (App, bool) {
+	for _, app := range r.Apps {
+		if app.ID == id {
+			return app, true
+		}
+	}
+	return App{}, false
+}
+
+// Select returns the apps in the specified category, grouped by group heading. If any audiences
+// are specified, only apps for those audiences are returned. Apps without a group heading are
+// listed in the first group.
+func (r Registry) Select(category Category, audiences ...Audience) []Group {
+	groups := make([]Group, 0)
+	for _, app := range r.Apps {
+		if app.Category != category {
+			continue
+		}
+		if len(audiences) > 0 && !slices.Contains(audiences, app.Audience) {
+			continue
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != app.Group {
+			groups = append(groups, Group{Name: app.Group})
+		}
+		groups[len(groups)-1].Apps = append(groups[len(groups)-1].Apps, app)
+	}
+	return groups
+}
+
+func (r Registry) String() string {
+	names := make([]string, 0, len(r.Apps))
+	for _, app := range r.Apps {
+		names = append(names, app.ID)
+	}
+	return fmt.Sprintf("[%s]", strings.Join(names, ", "))
+}
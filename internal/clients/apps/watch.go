@@ -0,0 +1,160 @@
+package apps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/handling"
+)
+
+// watchDebounce is how long to wait for filesystem changes to settle before reloading the
+// registry, since package managers usually add or remove several files at once.
+const watchDebounce = 500 * time.Millisecond
+
+// Watch watches the app registrations directory for changes until the context is canceled. After
+// each change, Watch invalidates the cached registry, reloads it, and notifies subscribers added
+// by [Client.Subscribe].
+func (c *Client) Watch(ctx context.Context) error {
+	if c.Config.Path == "" {
+		return nil
+	}
+	switch c.Config.WatchMode {
+	default:
+		return errors.Errorf("unknown watch mode %s", c.Config.WatchMode)
+	case WatchModeNone:
+		return nil
+	case WatchModePoll:
+		return c.watchPolling(ctx)
+	case WatchModeNotify:
+		err := c.watchNotifications(ctx)
+		if err == nil || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		c.Logger.Warn(errors.Wrapf(
+			err, "falling back to polling for changes to app registrations in %s", c.Config.Path,
+		))
+		return c.watchPolling(ctx)
+	}
+}
+
+func (c *Client) reload() {
+	c.Cache.UnsetRegistry()
+	registry, err := c.getRegistryFromFiles()
+	if err != nil {
+		c.Logger.Error(errors.Wrap(err, "couldn't reload app registry"))
+		return
+	}
+	c.hub.Broadcast(keyRegistry(), registry)
+}
+
+// Filesystem notifications
+
+func (c *Client) watchNotifications(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "couldn't start filesystem watcher")
+	}
+	defer func() {
+		if err := watcher.Close(); err != nil {
+			c.Logger.Error(errors.Wrap(err, "couldn't stop filesystem watcher"))
+		}
+	}()
+
+	dir := filepath.Clean(c.Config.Path)
+	// We also watch the parent directory so that we notice when the registrations directory is
+	// created, removed, or replaced (e.g. by a symlink to a different directory):
+	if err = watcher.Add(filepath.Dir(dir)); err != nil {
+		return errors.Wrapf(err, "couldn't watch parent directory of %s", dir)
+	}
+	if err = watcher.Add(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "couldn't watch %s", dir)
+	}
+	c.Logger.Infof("watching %s for changes to app registrations", dir)
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			c.Logger.Error(errors.Wrapf(err, "filesystem watcher for %s reported an error", dir))
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !c.affectsRegistry(dir, event) {
+				continue
+			}
+			if event.Name == dir && event.Has(fsnotify.Create) {
+				if err := watcher.Add(dir); err != nil {
+					c.Logger.Error(errors.Wrapf(err, "couldn't watch %s", dir))
+				}
+			}
+			debounce.Reset(watchDebounce)
+		case <-debounce.C:
+			c.reload()
+		}
+	}
+}
+
+func (c *Client) affectsRegistry(dir string, event fsnotify.Event) bool {
+	if event.Name == dir {
+		return !event.Has(fsnotify.Chmod)
+	}
+	if filepath.Dir(event.Name) != dir {
+		return false // this is an unrelated file in the parent directory
+	}
+	return isRegistrationFile(filepath.Base(event.Name))
+}
+
+// Polling
+
+func (c *Client) watchPolling(ctx context.Context) error {
+	c.Logger.Infof(
+		"polling %s every %s for changes to app registrations", c.Config.Path, c.Config.PollInterval,
+	)
+	prevFingerprint := c.fingerprintFiles()
+	return handling.Except(
+		handling.Repeat(ctx, c.Config.PollInterval, func() (done bool, err error) {
+			fingerprint := c.fingerprintFiles()
+			if fingerprint != prevFingerprint {
+				prevFingerprint = fingerprint
+				c.reload()
+			}
+			return false, nil
+		}),
+		context.Canceled,
+	)
+}
+
+// fingerprintFiles summarizes the names, sizes, and modification times of all registration files,
+// so that changes to registration files can be detected by comparing fingerprints.
+func (c *Client) fingerprintFiles() string {
+	entries, err := os.ReadDir(c.Config.Path)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !isRegistrationFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
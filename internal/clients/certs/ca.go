@@ -0,0 +1,185 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	caCertFile     = "ca.crt"
+	caKeyFile      = "ca.key"
+	issuedCertFile = "server.crt"
+	issuedKeyFile  = "server.key"
+
+	// caValidity is the validity period of generated certificate authorities. It's long, since
+	// users need to trust each new certificate authority manually.
+	caValidity = 10 * 365 * 24 * time.Hour
+)
+
+// GetCA returns the certificate of the machine's certificate authority, generating the certificate
+// authority if it doesn't exist yet. It returns nil if the TLS mode isn't ModeLocalCA.
+func (c *Client) GetCA() (*x509.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Config.Mode != ModeLocalCA {
+		return nil, nil
+	}
+	name, err := c.machineName.GetName()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't determine machine name for certificate authority")
+	}
+	ca, err := c.loadCA(name)
+	if err != nil {
+		return nil, err
+	}
+	return ca.Leaf, nil
+}
+
+// loadCA loads the persisted certificate authority, or generates and persists a new one if there
+// is no persisted certificate authority, if it's about to expire, or if it isn't constrained to
+// exactly the hostnames of the machine with the specified machine name.
+func (c *Client) loadCA(machineName string) (*tls.Certificate, error) {
+	hostnames := caHostnames(c.hostnames(machineName))
+	if c.ca != nil && !needsRenewal(c.ca.Leaf) &&
+		slices.Equal(c.ca.Leaf.PermittedDNSDomains, hostnames) {
+		return c.ca, nil
+	}
+
+	certPath := filepath.Join(c.Config.Dir, caCertFile)
+	keyPath := filepath.Join(c.Config.Dir, caKeyFile)
+	ca, err := tls.LoadX509KeyPair(certPath, keyPath)
+	switch {
+	case err == nil && ca.Leaf.IsCA && !needsRenewal(ca.Leaf) &&
+		slices.Equal(ca.Leaf.PermittedDNSDomains, hostnames):
+		c.ca = &ca
+		return c.ca, nil
+	case err == nil && ca.Leaf.IsCA && !needsRenewal(ca.Leaf):
+		c.Logger.Warnf(
+			"replacing certificate authority %s for hostnames %v with one for hostnames %v, which "+
+				"users will need to trust again",
+			certPath, ca.Leaf.PermittedDNSDomains, hostnames,
+		)
+	case err == nil:
+		c.Logger.Warnf(
+			"replacing expiring certificate authority %s, which users will need to trust again",
+			certPath,
+		)
+	case !errors.Is(err, os.ErrNotExist):
+		c.Logger.Warnf("replacing unusable certificate authority %s: %s", certPath, err.Error())
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate private key")
+	}
+	template, err := newCATemplate(machineName, hostnames)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := newCertificate(template, template, key, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeKeyPair(generated, key, certPath, keyPath); err != nil {
+		return nil, err
+	}
+	c.Logger.Infof("generated certificate authority %s", certPath)
+	c.ca = generated
+	return c.ca, nil
+}
+
+// caHostnames returns the sorted and deduplicated hostnames which a certificate authority for the
+// machine should be constrained to.
+func caHostnames(hostnames []string) []string {
+	return slices.Compact(slices.Sorted(slices.Values(hostnames)))
+}
+
+// newCATemplate makes a template for a certificate authority for the machine with the specified
+// machine name. The certificate authority is constrained to only issue certificates for the
+// machine's own hostnames (as returned by caHostnames) and loopback addresses, so that trusting it
+// doesn't let the machine impersonate other websites or other machines on the local network.
+func newCATemplate(machineName string, hostnames []string) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	commonName := "openUC2 device portal CA"
+	if machineName != "" {
+		commonName += " for " + machineName
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"openUC2"}},
+		// The start of the validity period is backdated to tolerate clock skew between machines
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		PermittedDNSDomains:   hostnames,
+		PermittedIPRanges: []*net.IPNet{
+			{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+			{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+		},
+	}, nil
+}
+
+// loadIssued loads the persisted certificate issued by the certificate authority, or issues and
+// persists a new one if there is no persisted certificate, if it isn't valid for all of the
+// hostnames of the machine with the specified machine name, if it wasn't issued by the current
+// certificate authority, or if it's about to expire.
+func (c *Client) loadIssued(machineName string) (*tls.Certificate, error) {
+	ca, err := c.loadCA(machineName)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't load certificate authority")
+	}
+	hostnames := c.hostnames(machineName)
+
+	certPath := filepath.Join(c.Config.Dir, issuedCertFile)
+	keyPath := filepath.Join(c.Config.Dir, issuedKeyFile)
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if !needsRenewal(cert.Leaf) && matchesHostnames(cert.Leaf, hostnames) &&
+			cert.Leaf.CheckSignatureFrom(ca.Leaf) == nil {
+			return &cert, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		c.Logger.Warnf("replacing unusable certificate %s: %s", certPath, err.Error())
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate private key")
+	}
+	template, err := newServerTemplate(hostnames)
+	if err != nil {
+		return nil, err
+	}
+	caKey, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("certificate authority's private key can't sign certificates")
+	}
+	cert, err := newCertificate(template, ca.Leaf, key, caKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeKeyPair(cert, key, certPath, keyPath); err != nil {
+		return nil, err
+	}
+	c.Logger.Infof("issued TLS certificate %s for %v", certPath, hostnames)
+	return cert, nil
+}
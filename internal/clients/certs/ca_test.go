@@ -0,0 +1,148 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/sargassum-world/godest/clientcache"
+
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+func newTestClient(t *testing.T, nameFile string) *Client {
+	t.Helper()
+	cache, err := clientcache.NewRistrettoCache(ristretto.Config{
+		NumCounters: 1e3, MaxCost: 1e6, BufferItems: 64,
+	})
+	if err != nil {
+		t.Fatalf("couldn't make cache: %s", err)
+	}
+	l := logging.NewLogger(logging.Config{}, io.Discard)
+	mnc := machinename.NewClient(machinename.Config{NameFile: nameFile}, cache, l)
+	return NewClient(Config{
+		Mode: ModeLocalCA,
+		Dir:  t.TempDir(),
+		Hostnames: func(machineName string) []string {
+			return []string{"openuc2-" + machineName + ".local", machineName + ".uc2", "openuc2.local"}
+		},
+	}, mnc, l)
+}
+
+func writeName(t *testing.T, nameFile, machineName string) {
+	t.Helper()
+	if err := os.WriteFile(nameFile, []byte(machineName+"\n"), 0o600); err != nil {
+		t.Fatalf("couldn't write machine name file: %s", err)
+	}
+}
+
+// issue makes a certificate for the hostname, signed by the certificate authority.
+func issue(t *testing.T, c *Client, hostname string) *x509.Certificate {
+	t.Helper()
+	ca, err := c.loadCA("abc123")
+	if err != nil {
+		t.Fatalf("couldn't load certificate authority: %s", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate private key: %s", err)
+	}
+	template, err := newServerTemplate([]string{hostname})
+	if err != nil {
+		t.Fatalf("couldn't make certificate template: %s", err)
+	}
+	cert, err := newCertificate(template, ca.Leaf, key, ca.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("couldn't make certificate: %s", err)
+	}
+	return cert.Leaf
+}
+
+func TestCANameConstraints(t *testing.T) {
+	t.Parallel()
+	nameFile := filepath.Join(t.TempDir(), "machine-name")
+	writeName(t, nameFile, "abc123")
+	c := newTestClient(t, nameFile)
+	ca, err := c.GetCA()
+	if err != nil {
+		t.Fatalf("couldn't get certificate authority: %s", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, tc := range []struct {
+		hostname string
+		valid    bool
+	}{
+		{hostname: "openuc2-abc123.local", valid: true},
+		{hostname: "abc123.uc2", valid: true},
+		{hostname: "openuc2.local", valid: true},
+		{hostname: "localhost", valid: true},
+		// Other machines on the local network can't be impersonated
+		{hostname: "openuc2-def456.local"},
+		{hostname: "def456.uc2"},
+		{hostname: "printer.local"},
+		// Other websites can't be impersonated
+		{hostname: "example.com"},
+	} {
+		t.Run(tc.hostname, func(t *testing.T) {
+			t.Parallel()
+			_, err := issue(t, c, tc.hostname).Verify(x509.VerifyOptions{
+				DNSName: tc.hostname, Roots: roots,
+			})
+			if tc.valid && err != nil {
+				t.Errorf("certificate for %s is invalid: %s", tc.hostname, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("certificate for %s is valid, expected it to violate name constraints", tc.hostname)
+			}
+		})
+	}
+}
+
+func TestCAMachineNameChange(t *testing.T) {
+	t.Parallel()
+	nameFile := filepath.Join(t.TempDir(), "machine-name")
+	writeName(t, nameFile, "abc123")
+	c := newTestClient(t, nameFile)
+	ca, err := c.GetCA()
+	if err != nil {
+		t.Fatalf("couldn't get certificate authority: %s", err)
+	}
+	if loaded, err := newTestClientAt(t, c.Config.Dir, nameFile).GetCA(); err != nil {
+		t.Fatalf("couldn't load certificate authority: %s", err)
+	} else if !loaded.Equal(ca) {
+		t.Errorf("persisted certificate authority was replaced without a machine name change")
+	}
+
+	// The certificate authority is only constrained to the hostnames for the old machine name
+	writeName(t, nameFile, "def456")
+	renamed, err := newTestClientAt(t, c.Config.Dir, nameFile).GetCA()
+	if err != nil {
+		t.Fatalf("couldn't get certificate authority: %s", err)
+	}
+	if renamed.Equal(ca) {
+		t.Fatalf("certificate authority wasn't replaced after a machine name change")
+	}
+	if !slices.Contains(renamed.PermittedDNSDomains, "openuc2-def456.local") ||
+		slices.Contains(renamed.PermittedDNSDomains, "openuc2-abc123.local") {
+		t.Errorf("replaced certificate authority has hostnames %v", renamed.PermittedDNSDomains)
+	}
+}
+
+// newTestClientAt makes a client which persists certificates in the directory, e.g. to simulate a
+// restart of the server.
+func newTestClientAt(t *testing.T, dir, nameFile string) *Client {
+	t.Helper()
+	c := newTestClient(t, nameFile)
+	c.Config.Dir = dir
+	return c
+}
@@ -0,0 +1,134 @@
+// Package certs provides the certificate for serving HTTPS, either from user-provided files or
+// generated for the machine's hostnames
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+type Client struct {
+	// Config should only be changed with the Reconfigure method.
+	Config Config
+	Logger godest.Logger
+
+	machineName *machinename.Client
+
+	mu sync.Mutex
+	// cert is the current certificate, which is loaded lazily.
+	cert *tls.Certificate
+	// certName is the machine name which the current certificate was generated for, in
+	// ModeSelfSigned and ModeLocalCA.
+	certName string
+	// ca is the certificate authority which issues the current certificate, in ModeLocalCA.
+	ca *tls.Certificate
+}
+
+func NewClient(c Config, machineName *machinename.Client, l godest.Logger) *Client {
+	return &Client{
+		Config:      c,
+		Logger:      l,
+		machineName: machineName,
+	}
+}
+
+// Reconfigure changes the client's config, e.g. when the config is reloaded, and forgets the
+// current certificate so that it will be loaded again. The TLS mode isn't changed, since HTTPS is
+// only started or stopped by a restart.
+func (c *Client) Reconfigure(config Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config.Mode = c.Config.Mode
+	c.Config = config
+	c.cert = nil
+	c.certName = ""
+	c.ca = nil
+}
+
+// GetMode returns the TLS mode.
+func (c *Client) GetMode() Mode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Config.Mode
+}
+
+// Enabled checks whether HTTPS should be served.
+func (c *Client) Enabled() bool {
+	return c.GetMode() != ModeNone
+}
+
+// GetCertificate returns the certificate for serving HTTPS; it can be used as the GetCertificate
+// callback of a [tls.Config], so that changes to the certificate files (after a config reload) or
+// to the machine name take effect without restarting the HTTPS server.
+func (c *Client) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.Config.Mode {
+	default:
+		return nil, errors.Errorf("TLS mode %s doesn't provide certificates", c.Config.Mode)
+	case ModeFile:
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		cert, err := tls.LoadX509KeyPair(c.Config.CertFile, c.Config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "couldn't load certificate %s with key %s", c.Config.CertFile, c.Config.KeyFile,
+			)
+		}
+		c.Logger.Infof("loaded TLS certificate from %s", c.Config.CertFile)
+		c.cert = &cert
+		return c.cert, nil
+	case ModeSelfSigned, ModeLocalCA:
+		name, err := c.machineName.GetName()
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't determine machine name for certificate")
+		}
+		if c.cert != nil && c.certName == name && !needsRenewal(c.cert.Leaf) {
+			return c.cert, nil
+		}
+		var cert *tls.Certificate
+		if c.Config.Mode == ModeSelfSigned {
+			cert, err = c.loadSelfSigned(c.hostnames(name))
+		} else {
+			cert, err = c.loadIssued(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.cert = cert
+		c.certName = name
+		return c.cert, nil
+	}
+}
+
+// hostnames returns the hostnames which generated certificates should be valid for, on the machine
+// with the specified machine name.
+func (c *Client) hostnames(machineName string) []string {
+	hostnames := []string{"localhost"}
+	if c.Config.Hostnames != nil {
+		hostnames = append(c.Config.Hostnames(machineName), hostnames...)
+	}
+	return hostnames
+}
+
+// Certificates
+
+// matchesHostnames checks whether the certificate is valid for all of the hostnames.
+func matchesHostnames(cert *x509.Certificate, hostnames []string) bool {
+	for _, hostname := range hostnames {
+		if cert.VerifyHostname(hostname) != nil {
+			return false
+		}
+	}
+	return true
+}
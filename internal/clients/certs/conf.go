@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const envPrefix = "TLS_"
+
+// Mode determines where the certificate for serving HTTPS comes from.
+type Mode string
+
+const (
+	// ModeNone disables HTTPS.
+	ModeNone Mode = "none"
+	// ModeFile loads a certificate and its private key from user-provided files.
+	ModeFile Mode = "file"
+	// ModeSelfSigned generates a self-signed certificate for the machine's hostnames, which is
+	// persisted in the certificates directory and regenerated when the hostnames change or when it's
+	// about to expire.
+	ModeSelfSigned Mode = "self-signed"
+	// ModeLocalCA generates a certificate authority (CA) for the machine, which issues a certificate
+	// for the machine's hostnames; both are persisted in the certificates directory, and the
+	// certificate is reissued when the hostnames change or when it's about to expire. Users can
+	// install the CA's certificate in their web browsers, so that browsers trust the machine.
+	ModeLocalCA Mode = "local-ca"
+)
+
+type Config struct {
+	Mode Mode
+	// CertFile is the path of a PEM-encoded certificate (optionally followed by its intermediate
+	// certificates), for ModeFile.
+	CertFile string
+	// KeyFile is the path of the certificate's PEM-encoded private key, for ModeFile.
+	KeyFile string
+	// Dir is the directory where generated certificates and keys are persisted.
+	Dir string
+
+	// Hostnames returns the hostnames of the machine with the specified machine name, which
+	// generated certificates should be valid for; it's set by the server.
+	Hostnames func(machineName string) []string
+}
+
+// Default values of TLS settings.
+const (
+	DefaultMode = ModeNone
+	// DefaultDir is a directory path specific to ImSwitch OS.
+	DefaultDir = "/var/lib/device-portal/tls"
+)
+
+func GetConfig() (c Config, err error) {
+	c.Mode = Mode(env.GetString(envPrefix+"MODE", string(DefaultMode)))
+	switch c.Mode {
+	default:
+		return Config{}, errors.Errorf(
+			"unknown TLS mode %s (must be one of: %s, %s, %s, %s)",
+			c.Mode, ModeNone, ModeFile, ModeSelfSigned, ModeLocalCA,
+		)
+	case ModeNone, ModeSelfSigned, ModeLocalCA:
+	case ModeFile:
+		c.CertFile = env.GetString(envPrefix+"CERTFILE", "")
+		c.KeyFile = env.GetString(envPrefix+"KEYFILE", "")
+		if c.CertFile == "" || c.KeyFile == "" {
+			return Config{}, errors.Errorf(
+				"TLS mode %s requires both a certificate file and a key file", c.Mode,
+			)
+		}
+	}
+
+	c.Dir = env.GetString(envPrefix+"DIR", DefaultDir)
+	return c, nil
+}
@@ -0,0 +1,146 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	selfSignedCertFile = "self-signed.crt"
+	selfSignedKeyFile  = "self-signed.key"
+
+	// serverCertValidity is the validity period of generated server certificates; browsers reject
+	// server certificates which are valid for longer than 398 days.
+	serverCertValidity = 397 * 24 * time.Hour
+	// renewalPeriod is how long before expiry generated certificates are regenerated.
+	renewalPeriod = 30 * 24 * time.Hour
+)
+
+// loadSelfSigned loads the persisted self-signed certificate, or generates and persists a new one
+// if there is no persisted certificate, if it isn't valid for all of the hostnames, or if it's
+// about to expire.
+func (c *Client) loadSelfSigned(hostnames []string) (*tls.Certificate, error) {
+	certPath := filepath.Join(c.Config.Dir, selfSignedCertFile)
+	keyPath := filepath.Join(c.Config.Dir, selfSignedKeyFile)
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if !needsRenewal(cert.Leaf) && matchesHostnames(cert.Leaf, hostnames) {
+			return &cert, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		c.Logger.Warnf("replacing unusable self-signed certificate %s: %s", certPath, err.Error())
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate private key")
+	}
+	template, err := newServerTemplate(hostnames)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := newCertificate(template, template, key, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeKeyPair(cert, key, certPath, keyPath); err != nil {
+		return nil, err
+	}
+	c.Logger.Infof("generated self-signed TLS certificate %s for %v", certPath, hostnames)
+	return cert, nil
+}
+
+// needsRenewal checks whether the certificate is about to expire.
+func needsRenewal(cert *x509.Certificate) bool {
+	return cert == nil || time.Now().Add(renewalPeriod).After(cert.NotAfter)
+}
+
+// newServerTemplate makes a template for a server certificate valid for the hostnames and for the
+// loopback addresses.
+func newServerTemplate(hostnames []string) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: hostnames[0]},
+		DNSNames:     hostnames,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		// The start of the validity period is backdated to tolerate clock skew between machines
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(serverCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	const serialNumberBits = 128
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate certificate serial number")
+	}
+	return serialNumber, nil
+}
+
+// newCertificate signs the template with the parent's private key, for a certificate with the
+// specified private key.
+func newCertificate(
+	template, parent *x509.Certificate, key *ecdsa.PrivateKey, parentKey crypto.Signer,
+) (*tls.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create certificate")
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse created certificate")
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// writeKeyPair persists the certificate (with any intermediate certificates) and its private key
+// as PEM files, creating their directories if necessary.
+func writeKeyPair(cert *tls.Certificate, key *ecdsa.PrivateKey, certPath, keyPath string) error {
+	rawKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return errors.Wrap(err, "couldn't serialize private key")
+	}
+	var rawCert []byte
+	for _, der := range cert.Certificate {
+		rawCert = append(rawCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	const dirPerm = 0o700
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err = os.MkdirAll(dir, dirPerm); err != nil {
+			return errors.Wrapf(err, "couldn't make directory %s", dir)
+		}
+	}
+	const keyPerm = 0o600
+	if err = os.WriteFile(
+		keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawKey}), keyPerm,
+	); err != nil {
+		return errors.Wrapf(err, "couldn't write private key %s", keyPath)
+	}
+	const certPerm = 0o644
+	if err = os.WriteFile(certPath, rawCert, certPerm); err != nil {
+		return errors.Wrapf(err, "couldn't write certificate %s", certPath)
+	}
+	return nil
+}
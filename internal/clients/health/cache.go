@@ -0,0 +1,39 @@
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sargassum-world/godest/clientcache"
+)
+
+type Cache struct {
+	Cache clientcache.Cache
+}
+
+// /health/apps/:id
+
+func keyResult(appID string) string {
+	return fmt.Sprintf("/health/apps/%s", appID)
+}
+
+func (c *Cache) SetResult(result Result, costWeight float32, ttl time.Duration) error {
+	key := keyResult(result.AppID)
+	return c.Cache.SetEntry(key, result, costWeight, ttl)
+}
+
+func (c *Cache) UnsetResult(appID string) {
+	key := keyResult(appID)
+	c.Cache.UnsetEntry(key)
+}
+
+func (c *Cache) GetResult(appID string) (Result, bool, error) {
+	key := keyResult(appID)
+	var value Result
+	keyExists, valueExists, err := c.Cache.GetEntry(key, &value)
+	if !keyExists || !valueExists || err != nil {
+		return Result{}, keyExists, err
+	}
+
+	return value, true, nil
+}
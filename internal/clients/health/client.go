@@ -0,0 +1,269 @@
+// Package health periodically probes the upstream services of registered apps to determine whether
+// those apps are running
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/clientcache"
+	"github.com/sargassum-world/godest/handling"
+	"github.com/sargassum-world/godest/pubsub"
+
+	"github.com/openUC2/device-portal/internal/clients/apps"
+)
+
+type Client struct {
+	Config Config
+	Logger godest.Logger
+	Cache  *Cache
+
+	ac         *apps.Client
+	httpClient *http.Client
+	hub        *pubsub.Hub[Result]
+
+	// This is guarded by mu:
+	probes map[string]*probe
+	mu     sync.Mutex
+}
+
+// probe tracks the state of health checks for an app.
+type probe struct {
+	registered time.Time
+	next       time.Time
+	running    bool
+	everUp     bool
+	status     Status
+}
+
+func NewClient(c Config, ac *apps.Client, cache clientcache.Cache, l godest.Logger) *Client {
+	return &Client{
+		Config: c,
+		Logger: l,
+		Cache: &Cache{
+			Cache: cache,
+		},
+		ac: ac,
+		httpClient: &http.Client{
+			Transport: http.DefaultTransport,
+		},
+		hub:    pubsub.NewHub[Result](nil, l),
+		probes: make(map[string]*probe),
+	}
+}
+
+// GetResult returns the result of the app's most recent health check.
+func (c *Client) GetResult(app apps.App) Result {
+	if app.Health == nil {
+		return Result{AppID: app.ID, Status: StatusUnknown}
+	}
+	result, cacheHit, err := c.Cache.GetResult(app.ID)
+	if err != nil {
+		c.Logger.Error(errors.Wrapf(err, "couldn't get the cache entry for health of app %s", app.ID))
+	}
+	if err != nil || !cacheHit {
+		// The app hasn't been checked yet (or its result expired because checks are stalled)
+		return Result{AppID: app.ID, Status: StatusStarting}
+	}
+	return result
+}
+
+// GetResults returns the results of the most recent health checks of all registered apps with
+// health checks, keyed by app ID.
+func (c *Client) GetResults() (map[string]Result, error) {
+	registry, err := c.ac.GetRegistry()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get app registry")
+	}
+	results := make(map[string]Result)
+	for _, app := range registry.Apps {
+		if app.Health == nil {
+			continue
+		}
+		results[app.ID] = c.GetResult(app)
+	}
+	return results, nil
+}
+
+// Subscribe adds a subscription to changes of the health status of any app. While the subscription
+// is active, the receive callback function will be called with the latest result for an app
+// whenever that app's status changes. The subscription is active until the callback function
+// returns an error or the context is done; the returned channel is closed when the subscription
+// becomes inactive.
+func (c *Client) Subscribe(
+	ctx context.Context, receive func(result Result) error,
+) (removed <-chan struct{}) {
+	return c.hub.Subscribe(ctx, "/health/apps", receive)
+}
+
+// Probing
+
+// schedulingInterval is the granularity at which health checks are scheduled.
+const schedulingInterval = time.Second
+
+// Run periodically checks the health of all registered apps with health checks, until the context
+// is canceled.
+func (c *Client) Run(ctx context.Context) error {
+	c.Logger.Infof("probing app health every %s", c.Config.Interval)
+	return handling.Except(
+		handling.RepeatImmediate(ctx, schedulingInterval, func() (done bool, err error) {
+			registry, err := c.ac.GetRegistry()
+			if err != nil {
+				c.Logger.Error(errors.Wrap(err, "couldn't get app registry for health checks"))
+				return false, nil
+			}
+			c.schedule(ctx, registry)
+			return false, nil
+		}),
+		context.Canceled,
+	)
+}
+
+// schedule launches health checks which are due for the registered apps, and forgets about apps
+// which are no longer registered.
+func (c *Client) schedule(ctx context.Context, registry apps.Registry) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	registered := make(map[string]struct{})
+	for _, app := range registry.Apps {
+		if app.Health == nil {
+			continue
+		}
+		registered[app.ID] = struct{}{}
+		p, ok := c.probes[app.ID]
+		if !ok {
+			p = &probe{registered: now, next: now}
+			c.probes[app.ID] = p
+		}
+		if p.running || now.Before(p.next) {
+			continue
+		}
+		p.running = true
+		p.next = now.Add(c.interval(app))
+		go c.probe(ctx, app)
+	}
+	for id := range c.probes {
+		if _, ok := registered[id]; !ok {
+			delete(c.probes, id)
+			c.Cache.UnsetResult(id)
+		}
+	}
+}
+
+func (c *Client) interval(app apps.App) time.Duration {
+	if app.Health.Interval > 0 {
+		return app.Health.Interval
+	}
+	return c.Config.Interval
+}
+
+func (c *Client) timeout(app apps.App) time.Duration {
+	if app.Health.Timeout > 0 {
+		return app.Health.Timeout
+	}
+	return c.Config.Timeout
+}
+
+func (c *Client) probe(ctx context.Context, app apps.App) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout(app))
+	defer cancel()
+	result := c.check(ctx, app)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return // the prober is shutting down, so the result is meaningless
+	}
+
+	c.mu.Lock()
+	p, ok := c.probes[app.ID]
+	if !ok {
+		// The app was unregistered while it was being checked
+		c.mu.Unlock()
+		return
+	}
+	p.running = false
+	switch result.Status {
+	case StatusUp, StatusDegraded:
+		p.everUp = true
+	case StatusDown:
+		if !p.everUp && time.Since(p.registered) < c.Config.StartupGrace {
+			result.Status = StatusStarting
+		}
+	}
+	changed := result.Status != p.status
+	p.status = result.Status
+	c.mu.Unlock()
+
+	// Results expire if checks stall, so that we don't keep reporting stale results
+	const expirationIntervals = 3
+	ttl := expirationIntervals * c.interval(app)
+	if err := c.Cache.SetResult(result, c.Config.CacheCost, ttl); err != nil {
+		c.Logger.Error(errors.Wrapf(err, "couldn't cache health of app %s", app.ID))
+	}
+	if changed {
+		c.Logger.Infof("app %s is now %s", app.ID, result.Status)
+		c.hub.Broadcast("/health/apps", result)
+	}
+}
+
+// Checks
+
+func (c *Client) check(ctx context.Context, app apps.App) (result Result) {
+	result.AppID = app.ID
+	result.Checked = time.Now()
+	var err error
+	switch {
+	case app.Health.HTTP != "":
+		result.Status, err = c.checkHTTP(ctx, app.Health.HTTP)
+	case app.Health.TCP != "":
+		result.Status, err = c.checkTCP(ctx, app.Health.TCP)
+	}
+	result.Latency = time.Since(result.Checked)
+	if err != nil {
+		result.Message = err.Error()
+	}
+	if result.Status == StatusUp && result.Latency > c.Config.DegradedLatency {
+		result.Status = StatusDegraded
+		result.Message = "responded slowly"
+	}
+	return result
+}
+
+func (c *Client) checkHTTP(ctx context.Context, url string) (Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return StatusDown, errors.Wrap(err, "couldn't make request")
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return StatusDown, errors.Wrap(err, "couldn't send request")
+	}
+	if err = res.Body.Close(); err != nil {
+		c.Logger.Warn(errors.Wrapf(err, "couldn't close response body from %s", url))
+	}
+	switch {
+	case res.StatusCode >= http.StatusInternalServerError:
+		return StatusDown, errors.Errorf("responded with status %s", res.Status)
+	case res.StatusCode >= http.StatusBadRequest:
+		return StatusDegraded, errors.Errorf("responded with status %s", res.Status)
+	default:
+		return StatusUp, nil
+	}
+}
+
+func (c *Client) checkTCP(ctx context.Context, address string) (Status, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return StatusDown, errors.Wrap(err, "couldn't connect")
+	}
+	if err = conn.Close(); err != nil {
+		c.Logger.Warn(errors.Wrapf(err, "couldn't close connection to %s", address))
+	}
+	return StatusUp, nil
+}
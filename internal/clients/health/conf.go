@@ -0,0 +1,66 @@
+package health
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const envPrefix = "HEALTH_"
+
+type Config struct {
+	Interval        time.Duration
+	Timeout         time.Duration
+	StartupGrace    time.Duration
+	DegradedLatency time.Duration
+
+	CacheCost float32
+}
+
+func getDuration(varName string, defaultValue string) (time.Duration, error) {
+	raw := env.GetString(varName, defaultValue)
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, errors.Wrapf(
+			err, "unparseable value %s for duration environment variable %s", raw, varName,
+		)
+	}
+	return d, nil
+}
+
+// Default values of health settings.
+const (
+	DefaultInterval = "10s"
+	DefaultTimeout  = "2s"
+	// DefaultStartupGrace is long, since ImSwitch can take a few minutes to boot on a Raspberry Pi.
+	DefaultStartupGrace    = "5m"
+	DefaultDegradedLatency = "1s"
+	DefaultCacheCost       = 1.0
+)
+
+func GetConfig() (c Config, err error) {
+	if c.Interval, err = getDuration(envPrefix+"INTERVAL", DefaultInterval); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make interval config")
+	}
+
+	if c.Timeout, err = getDuration(envPrefix+"TIMEOUT", DefaultTimeout); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make timeout config")
+	}
+
+	if c.StartupGrace, err = getDuration(envPrefix+"STARTUPGRACE", DefaultStartupGrace); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make startup grace period config")
+	}
+
+	if c.DegradedLatency, err = getDuration(
+		envPrefix+"DEGRADEDLATENCY", DefaultDegradedLatency,
+	); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make degraded latency config")
+	}
+
+	c.CacheCost, err = env.GetFloat32(envPrefix+"CACHE_COST", DefaultCacheCost)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make cache cost config")
+	}
+	return c, nil
+}
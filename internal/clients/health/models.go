@@ -0,0 +1,36 @@
+package health
+
+import (
+	"time"
+)
+
+// Status
+
+// A Status summarizes the health of an app's upstream service.
+type Status string
+
+const (
+	// StatusUnknown indicates that the app has no health check.
+	StatusUnknown Status = ""
+	// StatusUp indicates that the app's most recent health check succeeded.
+	StatusUp Status = "up"
+	// StatusDegraded indicates that the app's most recent health check succeeded, but the app's
+	// upstream service responded slowly or rejected the request.
+	StatusDegraded Status = "degraded"
+	// StatusDown indicates that the app's most recent health check failed.
+	StatusDown Status = "down"
+	// StatusStarting indicates that the app's health checks have not yet succeeded, but the app
+	// might still be starting up.
+	StatusStarting Status = "starting"
+)
+
+// Result
+
+// A Result is the outcome of an app's most recent health check.
+type Result struct {
+	AppID   string        `json:"app"`
+	Status  Status        `json:"status"`
+	Message string        `json:"message,omitempty"`
+	Checked time.Time     `json:"checked,omitzero"`
+	Latency time.Duration `json:"latency,omitempty"`
+}
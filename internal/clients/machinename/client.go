@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest"
@@ -15,9 +17,14 @@ import (
 )
 
 type Client struct {
+	// Config should only be changed with the Reconfigure method.
 	Config Config
 	Logger godest.Logger
 	Cache  *Cache
+
+	mu sync.RWMutex
+	// lookupFailures counts how many times the machine name couldn't be determined.
+	lookupFailures atomic.Uint64
 }
 
 func NewClient(c Config, cache clientcache.Cache, l godest.Logger) *Client {
@@ -30,6 +37,29 @@ func NewClient(c Config, cache clientcache.Cache, l godest.Logger) *Client {
 	}
 }
 
+// Reconfigure changes the client's config, e.g. when the config is reloaded, and forgets the
+// cached machine name so that it will be determined again.
+func (c *Client) Reconfigure(config Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Config = config
+	c.Cache.UnsetName()
+}
+
+func (c *Client) getConfig() Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.Config
+}
+
+// LookupFailures returns the number of times which the machine name couldn't be determined (so that
+// the fallback name was used) since the client was made.
+func (c *Client) LookupFailures() uint64 {
+	return c.lookupFailures.Load()
+}
+
 func (c *Client) GetName() (string, error) {
 	if name, cacheHit := c.getNameFromCache(); cacheHit {
 		c.Logger.Debugf("machine name was loaded from cache as %s", name)
@@ -51,13 +81,14 @@ func (c *Client) getNameFromCache() (string, bool) {
 func (c *Client) getNameFromSystem() (string, error) {
 	name, err := c.getMachineName()
 	if err != nil {
+		c.lookupFailures.Add(1)
 		c.Logger.Warnf(
 			"falling back to 'unknown' as the machine name, which couldn't be determined: %s",
 			err.Error(),
 		)
 		return "unknown", nil
 	}
-	if err := c.Cache.SetName(name, c.Config.CacheCost); err != nil {
+	if err := c.Cache.SetName(name, c.getConfig().CacheCost); err != nil {
 		return "", errors.Wrapf(err, "couldn't cache machine name %s", name)
 	}
 	if name != "" {
@@ -69,9 +100,10 @@ func (c *Client) getNameFromSystem() (string, error) {
 func (c *Client) getMachineName() (string, error) {
 	name := env.GetString(envPrefix+"NAME", "")
 	if name == "" {
-		rawFile, err := os.ReadFile(filepath.Clean(c.Config.NameFile))
+		nameFile := c.getConfig().NameFile
+		rawFile, err := os.ReadFile(filepath.Clean(nameFile))
 		if err != nil {
-			return "", errors.Wrapf(err, "couldn't read machine name from file %s", c.Config.NameFile)
+			return "", errors.Wrapf(err, "couldn't read machine name from file %s", nameFile)
 		}
 		name = strings.TrimSpace(string(rawFile))
 	}
@@ -13,13 +13,17 @@ type Config struct {
 	CacheCost float32
 }
 
+// Default values of machine name settings.
+const (
+	// DefaultNameFile is a file path specific to ImSwitch OS.
+	DefaultNameFile  = "/run/machine-name"
+	DefaultCacheCost = 1.0
+)
+
 func GetConfig() (c Config, err error) {
-	// This is a file path specific to ImSwitch OS
-	const defaultNameFilePath = "/run/machine-name"
-	c.NameFile = env.GetString(envPrefix+"NAMEFILE", defaultNameFilePath)
+	c.NameFile = env.GetString(envPrefix+"NAMEFILE", DefaultNameFile)
 
-	const defaultCacheCost = 1.0
-	c.CacheCost, err = env.GetFloat32(envPrefix+"CACHE_COST", defaultCacheCost)
+	c.CacheCost, err = env.GetFloat32(envPrefix+"CACHE_COST", DefaultCacheCost)
 	if err != nil {
 		return Config{}, errors.Wrap(err, "couldn't make cache cost config")
 	}
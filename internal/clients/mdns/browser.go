@@ -0,0 +1,146 @@
+package mdns
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/handling"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// portalsName returns the DNS-SD subtype name for browsing device portals.
+func portalsName() dnsmessage.Name {
+	return dnsmessage.MustNewName(Service{Type: ServiceType}.subtypeName(PortalSubtype))
+}
+
+// GetMachines returns the machines whose device portals were discovered on the local network
+// (excluding the current machine, whose responses to our own queries are also received) and
+// haven't expired from the cache, sorted by machine name.
+func (c *Client) GetMachines() []Machine {
+	c.mu.RLock()
+	instances := slices.Collect(maps.Keys(c.instances))
+	z := c.zone
+	c.mu.RUnlock()
+
+	machines := make([]Machine, 0, len(instances))
+	for _, instance := range instances {
+		if z.advertises(instance) {
+			continue
+		}
+		machine, cacheHit, err := c.Cache.GetMachine(instance)
+		if err != nil {
+			c.Logger.Error(errors.Wrapf(err, "couldn't get the cache entry for machine %s", instance))
+			continue
+		}
+		if !cacheHit {
+			c.forgetMachine(instance)
+			continue
+		}
+		machines = append(machines, machine)
+	}
+	slices.SortFunc(machines, func(a, b Machine) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)),
+			cmp.Compare(a.Instance, b.Instance),
+		)
+	})
+	return machines
+}
+
+// forgetMachine removes the machine from the list of discovered machines if the machine has expired
+// from the cache.
+func (c *Client) forgetMachine(instance string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The machine might have been re-discovered since we found that it had expired
+	if _, cacheHit, _ := c.Cache.GetMachine(instance); !cacheHit {
+		delete(c.instances, instance)
+	}
+}
+
+// browse periodically queries the local network for device portals until the context is canceled.
+func (c *Client) browse(ctx context.Context, conns []conn) error {
+	return handling.Except(
+		handling.RepeatImmediate(ctx, c.Config.BrowseInterval, func() (done bool, err error) {
+			for _, cn := range conns {
+				for _, ifi := range cn.interfaces() {
+					if err := c.write(cn, ifi.Index, cn.group(), dnsmessage.Message{
+						Questions: []dnsmessage.Question{{
+							Name: portalsName(), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET,
+						}},
+					}); err != nil {
+						c.Logger.Error(errors.Wrapf(err, "couldn't send mDNS query on %s", ifi.Name))
+					}
+				}
+			}
+			return false, nil
+		}),
+		context.Canceled,
+	)
+}
+
+// handleResponse caches any device portals fully described by the mDNS response; responses which
+// only describe part of a device portal's records (e.g. cache refreshes of single records) are
+// ignored, since device portals respond to our periodic queries with all of their records.
+func (c *Client) handleResponse(p *dnsmessage.Parser, src *net.UDPAddr) error {
+	if src != nil && src.Port != port {
+		return nil // RFC 6762 Section 11 requires us to ignore such responses
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return nil
+	}
+	if err = p.SkipAllAuthorities(); err != nil {
+		return nil
+	}
+	additionals, err := p.AllAdditionals()
+	if err != nil {
+		return nil
+	}
+	records := slices.Concat(answers, additionals)
+
+	for _, record := range records {
+		ptr, ok := record.Body.(*dnsmessage.PTRResource)
+		if !ok || !equalNames(record.Header.Name, portalsName()) {
+			continue
+		}
+		instance := strings.TrimSuffix(ptr.PTR.String(), ".")
+		machine, ttl, ok := newMachine(ptr.PTR, records)
+		if record.Header.TTL == 0 || (ok && ttl == 0) {
+			// This is a goodbye announcement
+			c.Cache.UnsetMachine(instance)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := c.setMachine(machine, time.Duration(ttl)*time.Second); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) setMachine(machine Machine, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Cache.SetMachine(machine, c.Config.CacheCost, ttl); err != nil {
+		return errors.Wrapf(err, "couldn't cache machine %s", machine.Instance)
+	}
+	if _, ok := c.instances[machine.Instance]; !ok {
+		c.Logger.Infof("discovered machine %s at %s", machine.Name, machine.URL())
+	}
+	c.instances[machine.Instance] = struct{}{}
+	return nil
+}
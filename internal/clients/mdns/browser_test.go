@@ -0,0 +1,317 @@
+package mdns
+
+import (
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeCache is a [clientcache.Cache] whose entries expire according to a fake clock, and whose
+// entries are available immediately after they're set.
+type fakeCache struct {
+	mu      sync.Mutex
+	now     time.Time
+	entries map[string]fakeCacheEntry
+}
+
+type fakeCacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{now: time.Now(), entries: make(map[string]fakeCacheEntry)}
+}
+
+func (c *fakeCache) SetEntry(key string, value any, _ float32, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := fakeCacheEntry{value: value}
+	if ttl >= 0 {
+		entry.expires = c.now.Add(ttl)
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *fakeCache) UnsetEntry(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *fakeCache) SetNonexistentEntry(key string, _ float32, ttl time.Duration) {
+	_ = c.SetEntry(key, nil, 0, ttl)
+}
+
+func (c *fakeCache) GetEntry(key string, value any) (keyExists, valueExists bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && !c.now.Before(entry.expires)) {
+		return false, false, nil
+	}
+	if entry.value == nil {
+		return true, false, nil
+	}
+	reflect.ValueOf(value).Elem().Set(reflect.ValueOf(entry.value))
+	return true, true, nil
+}
+
+// advance moves the fake clock forwards.
+func (c *fakeCache) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func newBrowsingClient(t *testing.T) (*Client, *fakeCache) {
+	t.Helper()
+	c := newTestClient(t)
+	cache := newFakeCache()
+	c.Cache = &Cache{Cache: cache}
+	c.Config.CacheCost = 1
+	c.instances = make(map[string]struct{})
+	return c, cache
+}
+
+// portalRecords returns the records which the device portal of the machine with the specified
+// machine name advertises, including an address record for its hostname.
+func portalRecords(t *testing.T, machineName, address string) []dnsmessage.Resource {
+	t.Helper()
+	z, errs := newZone("openuc2-"+machineName, []Service{{
+		Instance: "Machine " + machineName,
+		Type:     ServiceType,
+		Subtypes: []string{PortalSubtype},
+		Port:     80,
+		TXT:      []string{"path=/", "machine=" + machineName, "version=v1.0.0"},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("couldn't make zone: %s", errs)
+	}
+	return append(z.services[0].all(), dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name: z.host, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: hostTTL,
+		},
+		Body: &dnsmessage.AResource{A: [4]byte(net.ParseIP(address).To4())},
+	})
+}
+
+func portalMachine(machineName, address string) Machine {
+	return Machine{
+		Instance:  "Machine " + machineName + "._http._tcp.local",
+		Name:      machineName,
+		Version:   "v1.0.0",
+		Host:      "openuc2-" + machineName + ".local",
+		Port:      80,
+		Path:      "/",
+		Addresses: []string{address},
+	}
+}
+
+// handle feeds an mDNS response with the records (as answers) into the client.
+func handle(t *testing.T, c *Client, src *net.UDPAddr, records []dnsmessage.Resource) {
+	t.Helper()
+	packet, err := (&dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true}, Answers: records,
+	}).Pack()
+	if err != nil {
+		t.Fatalf("couldn't pack response: %s", err)
+	}
+	var p dnsmessage.Parser
+	if _, err = p.Start(packet); err != nil {
+		t.Fatalf("couldn't parse response: %s", err)
+	}
+	if err = c.handleResponse(&p, src); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestHandleResponse(t *testing.T) {
+	t.Parallel()
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 11), Port: port}
+	records := func(t *testing.T) []dnsmessage.Resource {
+		t.Helper()
+		return portalRecords(t, "other", "192.168.1.11")
+	}
+	without := func(records []dnsmessage.Resource, recordType dnsmessage.Type) []dnsmessage.Resource {
+		filtered := make([]dnsmessage.Resource, 0, len(records))
+		for _, record := range records {
+			if record.Header.Type != recordType {
+				filtered = append(filtered, record)
+			}
+		}
+		return filtered
+	}
+	for _, tc := range []struct {
+		name      string
+		src       *net.UDPAddr
+		responses func(t *testing.T) [][]dnsmessage.Resource
+		expected  []Machine
+	}{
+		{
+			name: "full response",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{records(t)}
+			},
+			expected: []Machine{portalMachine("other", "192.168.1.11")},
+		},
+		{
+			name: "without address",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{without(records(t), dnsmessage.TypeA)}
+			},
+			expected: []Machine{{
+				Instance: "Machine other._http._tcp.local", Name: "other", Version: "v1.0.0",
+				Host: "openuc2-other.local", Port: 80, Path: "/",
+			}},
+		},
+		{
+			name: "without SRV record",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{without(records(t), dnsmessage.TypeSRV)}
+			},
+		},
+		{
+			name: "without TXT record",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{without(records(t), dnsmessage.TypeTXT)}
+			},
+		},
+		{
+			name: "from another port",
+			src:  &net.UDPAddr{IP: src.IP, Port: 49152},
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{records(t)}
+			},
+		},
+		{
+			name: "goodbye",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{records(t), withTTL(records(t), 0)}
+			},
+		},
+		{
+			name: "goodbye of PTR record",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				var ptrs []dnsmessage.Resource
+				for _, record := range records(t) {
+					if record.Header.Type == dnsmessage.TypePTR {
+						ptrs = append(ptrs, record)
+					}
+				}
+				return [][]dnsmessage.Resource{records(t), withTTL(ptrs, 0)}
+			},
+		},
+		{
+			name: "rediscovery after goodbye",
+			src:  src,
+			responses: func(t *testing.T) [][]dnsmessage.Resource {
+				return [][]dnsmessage.Resource{records(t), withTTL(records(t), 0), records(t)}
+			},
+			expected: []Machine{portalMachine("other", "192.168.1.11")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c, _ := newBrowsingClient(t)
+			for _, response := range tc.responses(t) {
+				handle(t, c, tc.src, response)
+			}
+			if machines := c.GetMachines(); !slices.EqualFunc(
+				machines, tc.expected, func(a, b Machine) bool { return reflect.DeepEqual(a, b) },
+			) {
+				t.Errorf("got machines %+v, expected %+v", machines, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetMachinesExpiry(t *testing.T) {
+	t.Parallel()
+	c, cache := newBrowsingClient(t)
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 11), Port: port}
+	handle(t, c, src, portalRecords(t, "other", "192.168.1.11"))
+	if machines := c.GetMachines(); len(machines) != 1 {
+		t.Fatalf("got machines %+v, expected 1 machine", machines)
+	}
+
+	// Machines expire after the shortest TTL of their SRV and TXT records
+	cache.advance(hostTTL * time.Second)
+	if machines := c.GetMachines(); len(machines) > 0 {
+		t.Errorf("got machines %+v after they expired, expected none", machines)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.instances) > 0 {
+		t.Errorf("expired machines %+v weren't forgotten", c.instances)
+	}
+}
+
+func TestGetMachines(t *testing.T) {
+	t.Parallel()
+	c, _ := newBrowsingClient(t)
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 11), Port: port}
+	for _, machineName := range []string{"gamma", "beta", "Alpha"} {
+		handle(t, c, src, portalRecords(t, machineName, "192.168.1.11"))
+	}
+	// Two machines with the same machine name are ordered by their service instance names
+	duplicate := portalRecords(t, "beta", "192.168.1.12")
+	for i, record := range duplicate {
+		if record.Header.Type == dnsmessage.TypeA {
+			continue
+		}
+		duplicate[i] = renameInstance(t, record, "Machine beta", "Machine beta (2)")
+	}
+	handle(t, c, src, duplicate)
+	// The current machine receives its own responses to its queries
+	handle(t, c, src, c.getZone().services[0].all())
+
+	duplicateMachine := portalMachine("beta", "192.168.1.12")
+	duplicateMachine.Instance = "Machine beta (2)._http._tcp.local"
+	expected := []Machine{
+		portalMachine("Alpha", "192.168.1.11"),
+		duplicateMachine,
+		portalMachine("beta", "192.168.1.11"),
+		portalMachine("gamma", "192.168.1.11"),
+	}
+	// The order of discovered machines shouldn't depend on the order of map iteration
+	for range 10 {
+		if machines := c.GetMachines(); !reflect.DeepEqual(machines, expected) {
+			t.Fatalf("got machines %+v, expected %+v", machines, expected)
+		}
+	}
+}
+
+// renameInstance replaces the service instance name in the record's name or in its PTR target.
+func renameInstance(t *testing.T, record dnsmessage.Resource, from, to string) dnsmessage.Resource {
+	t.Helper()
+	rename := func(name dnsmessage.Name) dnsmessage.Name {
+		renamed, err := dnsmessage.NewName(strings.Replace(name.String(), from+".", to+".", 1))
+		if err != nil {
+			t.Fatalf("couldn't rename %s: %s", name, err)
+		}
+		return renamed
+	}
+	record.Header.Name = rename(record.Header.Name)
+	if ptr, ok := record.Body.(*dnsmessage.PTRResource); ok {
+		record.Body = &dnsmessage.PTRResource{PTR: rename(ptr.PTR)}
+	}
+	return record
+}
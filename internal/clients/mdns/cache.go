@@ -0,0 +1,40 @@
+package mdns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sargassum-world/godest/clientcache"
+)
+
+type Cache struct {
+	Cache clientcache.Cache
+}
+
+// /mdns/machines/:instance
+
+func keyMachine(instance string) string {
+	return fmt.Sprintf("/mdns/machines/%s", strings.ToLower(instance))
+}
+
+func (c *Cache) SetMachine(machine Machine, costWeight float32, ttl time.Duration) error {
+	key := keyMachine(machine.Instance)
+	return c.Cache.SetEntry(key, machine, costWeight, ttl)
+}
+
+func (c *Cache) UnsetMachine(instance string) {
+	key := keyMachine(instance)
+	c.Cache.UnsetEntry(key)
+}
+
+func (c *Cache) GetMachine(instance string) (Machine, bool, error) {
+	key := keyMachine(instance)
+	var value Machine
+	keyExists, valueExists, err := c.Cache.GetEntry(key, &value)
+	if !keyExists || !valueExists || err != nil {
+		return Machine{}, keyExists, err
+	}
+
+	return value, true, nil
+}
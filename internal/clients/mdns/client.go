@@ -0,0 +1,137 @@
+// Package mdns advertises the device portal and the apps registered on the machine over multicast
+// DNS (mDNS) with DNS-Based Service Discovery (DNS-SD), so that users and other machines on the
+// local network can find them without typing hostnames, and discovers the device portals of other
+// machines on the local network
+package mdns
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+	"github.com/sargassum-world/godest/clientcache"
+
+	"github.com/openUC2/device-portal/internal/clients/apps"
+	"github.com/openUC2/device-portal/internal/clients/machinename"
+)
+
+const (
+	// ServiceType is the DNS-SD service type of the device portal and of apps.
+	ServiceType = "_http._tcp"
+	// PortalSubtype is the DNS-SD subtype which distinguishes device portals from other HTTP
+	// services.
+	PortalSubtype = "_device-portal"
+)
+
+type Client struct {
+	Config Config
+	Logger godest.Logger
+	Cache  *Cache
+
+	mnc *machinename.Client
+	ac  *apps.Client
+
+	// changes has a pending notification when the advertised services need to be updated
+	changes chan struct{}
+
+	// These are guarded by mu:
+	zone zone
+	// instances has the service instance names of discovered machines
+	instances map[string]struct{}
+	mu        sync.RWMutex
+}
+
+func NewClient(
+	c Config, mnc *machinename.Client, ac *apps.Client, cache clientcache.Cache, l godest.Logger,
+) *Client {
+	return &Client{
+		Config: c,
+		Logger: l,
+		Cache: &Cache{
+			Cache: cache,
+		},
+		mnc:       mnc,
+		ac:        ac,
+		changes:   make(chan struct{}, 1),
+		instances: make(map[string]struct{}),
+	}
+}
+
+// Refresh makes the responder update and re-announce the advertised services, e.g. after the
+// machine name has changed.
+func (c *Client) Refresh() {
+	select {
+	default: // a refresh is already pending
+	case c.changes <- struct{}{}:
+	}
+}
+
+// GetServices returns the services to advertise: the device portal itself, and every registered
+// app which is served over HTTP by the machine.
+func (c *Client) GetServices() ([]Service, error) {
+	machineName, err := c.mnc.GetName()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't determine machine name")
+	}
+	registry, err := c.ac.GetRegistry()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't load app registry")
+	}
+
+	txt := []string{"machine=" + machineName, "version=" + c.Config.Version}
+	services := []Service{{
+		Instance: "Machine " + machineName,
+		Type:     ServiceType,
+		Subtypes: []string{PortalSubtype},
+		Port:     c.Config.Port,
+		TXT:      append([]string{"path=" + c.Config.Path}, txt...),
+	}}
+	for _, app := range registry.Apps {
+		path := app.URL
+		if path == "" && app.Port != 0 {
+			path = "/"
+		}
+		if !strings.HasPrefix(path, "/") {
+			continue // the app isn't served by the machine, or it isn't a browser app
+		}
+		port := app.Port
+		if port == 0 {
+			port = c.Config.Port
+		}
+		services = append(services, Service{
+			Instance: app.Name + " on machine " + machineName,
+			Type:     ServiceType,
+			Port:     port,
+			TXT:      append([]string{"path=" + path, "app=" + app.ID}, txt...),
+		})
+	}
+	return services, nil
+}
+
+func (c *Client) getZone() zone {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.zone
+}
+
+// updateZone replaces the published records with records for the current services. If the
+// current services can't be determined, the previously-published records are kept.
+func (c *Client) updateZone() zone {
+	services, err := c.GetServices()
+	if err != nil {
+		c.Logger.Error(errors.Wrap(err, "couldn't determine services to advertise over mDNS"))
+		return c.getZone()
+	}
+	z, errs := newZone(c.Config.Hostname, services)
+	for _, err := range errs {
+		c.Logger.Error(errors.Wrap(err, "couldn't make mDNS records"))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.zone = z
+	return z
+}
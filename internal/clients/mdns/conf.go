@@ -0,0 +1,86 @@
+package mdns
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/env"
+)
+
+const envPrefix = "MDNS_"
+
+type Config struct {
+	Enabled bool
+	// Hostname is the name (without the .local domain) of the host which advertised services are
+	// provided by.
+	Hostname string
+	// Interfaces is an optional list of names of network interfaces to use for mDNS; if it's empty,
+	// all multicast-capable network interfaces are used.
+	Interfaces []string
+	// Port is the port which the device portal is accessed on; it should be overridden when the
+	// device portal is accessed through a reverse-proxy.
+	Port int
+
+	// BrowseInterval is the interval between queries for other device portals on the local network.
+	BrowseInterval time.Duration
+
+	// Path is the path of the device portal's home page, set by the server.
+	Path string
+	// Version is the version of the device-portal program, set by the server.
+	Version string
+
+	CacheCost float32
+}
+
+// Default values of mDNS settings. The default hostname is the machine's hostname.
+const (
+	DefaultEnabled        = "true"
+	DefaultBrowseInterval = "1m"
+	DefaultCacheCost      = 1.0
+)
+
+func GetConfig() (c Config, err error) {
+	rawEnabled := env.GetString(envPrefix+"ENABLED", DefaultEnabled)
+	if c.Enabled, err = strconv.ParseBool(rawEnabled); err != nil {
+		return Config{}, errors.Wrapf(err, "couldn't parse enabled config %s", rawEnabled)
+	}
+
+	defaultHostname, err := os.Hostname()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't determine default hostname")
+	}
+	c.Hostname = strings.TrimSuffix(
+		strings.TrimSuffix(env.GetString(envPrefix+"HOSTNAME", defaultHostname), "."), ".local",
+	)
+	if c.Hostname == "" {
+		return Config{}, errors.New("hostname must not be empty")
+	}
+
+	c.Interfaces = strings.FieldsFunc(env.GetString(envPrefix+"INTERFACES", ""), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	const maxPort = 65535
+	rawPort, err := env.GetInt64(envPrefix+"PORT", 0)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make port config")
+	}
+	if rawPort < 0 || rawPort > maxPort {
+		return Config{}, errors.Errorf("port %d is out of range", rawPort)
+	}
+	c.Port = int(rawPort)
+
+	rawBrowseInterval := env.GetString(envPrefix+"BROWSEINTERVAL", DefaultBrowseInterval)
+	if c.BrowseInterval, err = time.ParseDuration(rawBrowseInterval); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make browse interval config")
+	}
+
+	c.CacheCost, err = env.GetFloat32(envPrefix+"CACHE_COST", DefaultCacheCost)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make cache cost config")
+	}
+	return c, nil
+}
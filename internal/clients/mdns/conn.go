@@ -0,0 +1,235 @@
+package mdns
+
+import (
+	"net"
+	"slices"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	port = 5353
+	// maxPacketSize is the maximum size of mDNS messages, specified by RFC 6762 Section 17.
+	maxPacketSize = 9000
+	// multicastTTL is the IP TTL (or IPv6 hop limit) required by RFC 6762 Section 11.
+	multicastTTL = 255
+)
+
+var (
+	groupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: port}
+	groupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: port}
+)
+
+// A conn is a UDP socket which has joined the mDNS multicast group (for one IP version) on some
+// network interfaces.
+type conn interface {
+	// read reads a packet, returning the index of the network interface which received it.
+	read(b []byte) (n, ifIndex int, src *net.UDPAddr, err error)
+	// write writes a packet out of the network interface with the specified index.
+	write(b []byte, ifIndex int, dst *net.UDPAddr) error
+	// group returns the mDNS multicast group address.
+	group() *net.UDPAddr
+	// interfaces returns the network interfaces which have joined the mDNS multicast group.
+	interfaces() []net.Interface
+	close() error
+}
+
+// selectInterfaces returns the up, multicast-capable network interfaces, filtered by name if any
+// names are specified.
+func selectInterfaces(names []string) ([]net.Interface, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list network interfaces")
+	}
+	selected := make([]net.Interface, 0, len(ifis))
+	for _, ifi := range ifis {
+		if len(names) > 0 && !slices.Contains(names, ifi.Name) {
+			continue
+		}
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		selected = append(selected, ifi)
+	}
+	return selected, nil
+}
+
+// hasAddress checks whether the network interface has an address of the specified IP version.
+func hasAddress(ifi net.Interface, v4 bool) bool {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(addrs, func(addr net.Addr) bool {
+		ipNet, ok := addr.(*net.IPNet)
+		return ok && (ipNet.IP.To4() != nil) == v4
+	})
+}
+
+// listenMulticast opens a UDP socket bound to the mDNS multicast group on the first network
+// interface; net.ListenMulticastUDP sets SO_REUSEADDR, so that the socket can be shared with any
+// other mDNS responder (e.g. Avahi) running on the host.
+func listenMulticast(
+	network string, ifis []net.Interface, group *net.UDPAddr,
+) (*net.UDPConn, error) {
+	if len(ifis) == 0 {
+		return nil, errors.Errorf("no network interfaces available for %s", network)
+	}
+	udpConn, err := net.ListenMulticastUDP(network, &ifis[0], group)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't listen for %s multicast on %s", network, ifis[0].Name)
+	}
+	return udpConn, nil
+}
+
+// IPv4
+
+type ipv4Conn struct {
+	pc     *ipv4.PacketConn
+	joined []net.Interface
+}
+
+// listenIPv4 opens an mDNS socket for IPv4, returning errors for any network interfaces which
+// couldn't join the mDNS multicast group.
+func listenIPv4(ifis []net.Interface) (c *ipv4Conn, errs []error) {
+	ifis = slices.DeleteFunc(slices.Clone(ifis), func(ifi net.Interface) bool {
+		return !hasAddress(ifi, true)
+	})
+	udpConn, err := listenMulticast("udp4", ifis, groupIPv4)
+	if err != nil {
+		return nil, []error{err}
+	}
+	c = &ipv4Conn{
+		pc:     ipv4.NewPacketConn(udpConn),
+		joined: []net.Interface{ifis[0]},
+	}
+	for _, ifi := range ifis[1:] {
+		if err := c.pc.JoinGroup(&ifi, groupIPv4); err != nil {
+			errs = append(errs, errors.Wrapf(err, "couldn't join IPv4 multicast group on %s", ifi.Name))
+			continue
+		}
+		c.joined = append(c.joined, ifi)
+	}
+	if err := configureIPv4(c.pc); err != nil {
+		_ = c.pc.Close()
+		return nil, append(errs, err)
+	}
+	return c, errs
+}
+
+func configureIPv4(pc *ipv4.PacketConn) error {
+	if err := pc.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+		return errors.Wrap(err, "couldn't enable IPv4 interface control messages")
+	}
+	if err := pc.SetMulticastTTL(multicastTTL); err != nil {
+		return errors.Wrap(err, "couldn't set IPv4 multicast TTL")
+	}
+	// Loopback allows other programs on the host (e.g. other mDNS clients) to receive our packets
+	if err := pc.SetMulticastLoopback(true); err != nil {
+		return errors.Wrap(err, "couldn't enable IPv4 multicast loopback")
+	}
+	return nil
+}
+
+func (c *ipv4Conn) read(b []byte) (n, ifIndex int, src *net.UDPAddr, err error) {
+	n, cm, addr, err := c.pc.ReadFrom(b)
+	if cm != nil {
+		ifIndex = cm.IfIndex
+	}
+	src, _ = addr.(*net.UDPAddr)
+	return n, ifIndex, src, err
+}
+
+func (c *ipv4Conn) write(b []byte, ifIndex int, dst *net.UDPAddr) error {
+	_, err := c.pc.WriteTo(b, &ipv4.ControlMessage{IfIndex: ifIndex}, dst)
+	return err
+}
+
+func (c *ipv4Conn) group() *net.UDPAddr {
+	return groupIPv4
+}
+
+func (c *ipv4Conn) interfaces() []net.Interface {
+	return c.joined
+}
+
+func (c *ipv4Conn) close() error {
+	return c.pc.Close()
+}
+
+// IPv6
+
+type ipv6Conn struct {
+	pc     *ipv6.PacketConn
+	joined []net.Interface
+}
+
+// listenIPv6 opens an mDNS socket for IPv6, returning errors for any network interfaces which
+// couldn't join the mDNS multicast group.
+func listenIPv6(ifis []net.Interface) (c *ipv6Conn, errs []error) {
+	ifis = slices.DeleteFunc(slices.Clone(ifis), func(ifi net.Interface) bool {
+		return !hasAddress(ifi, false)
+	})
+	udpConn, err := listenMulticast("udp6", ifis, groupIPv6)
+	if err != nil {
+		return nil, []error{err}
+	}
+	c = &ipv6Conn{
+		pc:     ipv6.NewPacketConn(udpConn),
+		joined: []net.Interface{ifis[0]},
+	}
+	for _, ifi := range ifis[1:] {
+		if err := c.pc.JoinGroup(&ifi, groupIPv6); err != nil {
+			errs = append(errs, errors.Wrapf(err, "couldn't join IPv6 multicast group on %s", ifi.Name))
+			continue
+		}
+		c.joined = append(c.joined, ifi)
+	}
+	if err := configureIPv6(c.pc); err != nil {
+		_ = c.pc.Close()
+		return nil, append(errs, err)
+	}
+	return c, errs
+}
+
+func configureIPv6(pc *ipv6.PacketConn) error {
+	if err := pc.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		return errors.Wrap(err, "couldn't enable IPv6 interface control messages")
+	}
+	if err := pc.SetMulticastHopLimit(multicastTTL); err != nil {
+		return errors.Wrap(err, "couldn't set IPv6 multicast hop limit")
+	}
+	// Loopback allows other programs on the host (e.g. other mDNS clients) to receive our packets
+	if err := pc.SetMulticastLoopback(true); err != nil {
+		return errors.Wrap(err, "couldn't enable IPv6 multicast loopback")
+	}
+	return nil
+}
+
+func (c *ipv6Conn) read(b []byte) (n, ifIndex int, src *net.UDPAddr, err error) {
+	n, cm, addr, err := c.pc.ReadFrom(b)
+	if cm != nil {
+		ifIndex = cm.IfIndex
+	}
+	src, _ = addr.(*net.UDPAddr)
+	return n, ifIndex, src, err
+}
+
+func (c *ipv6Conn) write(b []byte, ifIndex int, dst *net.UDPAddr) error {
+	_, err := c.pc.WriteTo(b, &ipv6.ControlMessage{IfIndex: ifIndex}, dst)
+	return err
+}
+
+func (c *ipv6Conn) group() *net.UDPAddr {
+	return groupIPv6
+}
+
+func (c *ipv6Conn) interfaces() []net.Interface {
+	return c.joined
+}
+
+func (c *ipv6Conn) close() error {
+	return c.pc.Close()
+}
@@ -0,0 +1,396 @@
+package mdns
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	domain = "local."
+	// servicesName is the name for DNS-SD service type enumeration (RFC 6763 Section 9).
+	servicesName = "_services._dns-sd._udp." + domain
+
+	// hostTTL is the TTL (in seconds) recommended by RFC 6762 Section 10 for records containing
+	// hostnames, e.g. SRV and address records.
+	hostTTL = 120
+	// otherTTL is the TTL (in seconds) recommended by RFC 6762 Section 10 for other records.
+	otherTTL = 4500
+	// legacyTTL is the maximum TTL (in seconds) for responses to legacy unicast queries, specified by
+	// RFC 6762 Section 6.7.
+	legacyTTL = 10
+
+	// cacheFlush is the bit of a resource record's class which marks the record as unique, i.e. as
+	// replacing any other records with the same name and type (RFC 6762 Section 10.2).
+	cacheFlush dnsmessage.Class = 1 << 15
+	// unicastResponse is the bit of a question's class which requests a unicast response (RFC 6762
+	// Section 5.4).
+	unicastResponse dnsmessage.Class = 1 << 15
+
+	maxLabelLength = 63
+)
+
+// Service
+
+// A Service is a DNS-SD service instance (RFC 6763) to advertise over mDNS.
+type Service struct {
+	// Instance is the human-readable name of the service instance, e.g. "Machine abc".
+	Instance string
+	// Type is the service type, e.g. "_http._tcp".
+	Type string
+	// Subtypes is an optional list of DNS-SD subtypes which clients can browse for, e.g.
+	// "_device-portal".
+	Subtypes []string
+	// Port is the port which the service is provided on.
+	Port int
+	// TXT is the list of key=value pairs in the service's TXT record.
+	TXT []string
+}
+
+func (s Service) typeName() string {
+	return s.Type + "." + domain
+}
+
+func (s Service) subtypeName(subtype string) string {
+	return subtype + "._sub." + s.typeName()
+}
+
+func (s Service) instanceName() string {
+	return instanceLabel(s.Instance) + "." + s.typeName()
+}
+
+// instanceLabel makes a DNS label from the human-readable name of a service instance. Because
+// dnsmessage doesn't support escaped dots in labels, dots are replaced with hyphens.
+func instanceLabel(instance string) string {
+	label := strings.ReplaceAll(instance, ".", "-")
+	if len(label) <= maxLabelLength {
+		return label
+	}
+	label = label[:maxLabelLength]
+	for !utf8.ValidString(label) {
+		label = label[:len(label)-1] // remove any truncated multi-byte character
+	}
+	return label
+}
+
+// serviceRecords is the set of DNS records which advertise a service.
+type serviceRecords struct {
+	service Service
+	// ptrs has the service type's PTR record, followed by any subtypes' PTR records.
+	ptrs []dnsmessage.Resource
+	srv  dnsmessage.Resource
+	txt  dnsmessage.Resource
+}
+
+func newServiceRecords(s Service, host dnsmessage.Name) (r serviceRecords, err error) {
+	r.service = s
+	instance, err := dnsmessage.NewName(s.instanceName())
+	if err != nil {
+		return serviceRecords{}, errors.Wrapf(err, "invalid instance name for %s", s.Instance)
+	}
+	ptrNames := []string{s.typeName()}
+	for _, subtype := range s.Subtypes {
+		ptrNames = append(ptrNames, s.subtypeName(subtype))
+	}
+	for _, ptrName := range ptrNames {
+		name, err := dnsmessage.NewName(ptrName)
+		if err != nil {
+			return serviceRecords{}, errors.Wrapf(err, "invalid service type name %s", ptrName)
+		}
+		r.ptrs = append(r.ptrs, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: otherTTL,
+			},
+			Body: &dnsmessage.PTRResource{PTR: instance},
+		})
+	}
+	r.srv = dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  instance,
+			Type:  dnsmessage.TypeSRV,
+			Class: dnsmessage.ClassINET | cacheFlush,
+			TTL:   hostTTL,
+		},
+		//nolint:gosec // ports are validated by the config and by app registrations
+		Body: &dnsmessage.SRVResource{Target: host, Port: uint16(s.Port)},
+	}
+	txt := s.TXT
+	if len(txt) == 0 {
+		txt = []string{""} // RFC 6763 Section 6.1 requires at least one string
+	}
+	r.txt = dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  instance,
+			Type:  dnsmessage.TypeTXT,
+			Class: dnsmessage.ClassINET | cacheFlush,
+			TTL:   otherTTL,
+		},
+		Body: &dnsmessage.TXTResource{TXT: txt},
+	}
+	return r, nil
+}
+
+func (r serviceRecords) all() []dnsmessage.Resource {
+	return append(slices.Clone(r.ptrs), r.srv, r.txt)
+}
+
+// Machine
+
+// A Machine is a machine whose device portal was discovered on the local network.
+type Machine struct {
+	// Instance is the DNS-SD service instance name of the machine's device portal.
+	Instance string `json:"instance"`
+	// Name is the machine name.
+	Name string `json:"name"`
+	// Version is the version of the machine's device portal.
+	Version string `json:"version,omitempty"`
+	// Host is the mDNS hostname (e.g. openuc2-abc.local) of the machine.
+	Host string `json:"host"`
+	// Port is the port which the machine's device portal is accessed on.
+	Port int `json:"port"`
+	// Path is the path of the machine's device portal.
+	Path string `json:"path"`
+	// Addresses are the IP addresses of the machine on the local network.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// URL returns the URL of the machine's device portal at the machine's mDNS hostname.
+func (m Machine) URL() string {
+	return m.url(m.Host)
+}
+
+// AddressURLs returns the URLs of the machine's device portal at each of the machine's IP
+// addresses, excluding link-local addresses (which can't be used in URLs without a zone).
+func (m Machine) AddressURLs() []string {
+	urls := make([]string, 0, len(m.Addresses))
+	for _, rawAddr := range m.Addresses {
+		addr, err := netip.ParseAddr(rawAddr)
+		if err != nil || addr.IsLinkLocalUnicast() {
+			continue
+		}
+		urls = append(urls, m.url(addr.String()))
+	}
+	return urls
+}
+
+func (m Machine) url(host string) string {
+	const defaultHTTPPort = 80
+	u := url.URL{Scheme: "http", Host: host, Path: m.Path}
+	if m.Port != defaultHTTPPort {
+		u.Host = net.JoinHostPort(host, strconv.Itoa(m.Port))
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	return u.String()
+}
+
+// newMachine makes a Machine from the records for the service instance of a device portal. The
+// returned TTL is the shortest TTL of the records used.
+func newMachine(
+	instance dnsmessage.Name, records []dnsmessage.Resource,
+) (m Machine, ttl uint32, ok bool) {
+	m.Instance = strings.TrimSuffix(instance.String(), ".")
+	var host dnsmessage.Name
+	hasSRV := false
+	ttl = otherTTL
+	for _, record := range records {
+		if !equalNames(record.Header.Name, instance) {
+			continue
+		}
+		switch body := record.Body.(type) {
+		case *dnsmessage.SRVResource:
+			host = body.Target
+			m.Port = int(body.Port)
+			hasSRV = true
+			ttl = min(ttl, record.Header.TTL)
+		case *dnsmessage.TXTResource:
+			for _, entry := range body.TXT {
+				key, value, _ := strings.Cut(entry, "=")
+				switch strings.ToLower(key) {
+				case "machine":
+					m.Name = value
+				case "version":
+					m.Version = value
+				case "path":
+					m.Path = value
+				}
+			}
+			ttl = min(ttl, record.Header.TTL)
+		}
+	}
+	if !hasSRV || m.Name == "" {
+		return Machine{}, 0, false
+	}
+	m.Host = strings.TrimSuffix(host.String(), ".")
+
+	for _, record := range records {
+		if !equalNames(record.Header.Name, host) {
+			continue
+		}
+		switch body := record.Body.(type) {
+		case *dnsmessage.AResource:
+			m.Addresses = append(m.Addresses, netip.AddrFrom4(body.A).String())
+		case *dnsmessage.AAAAResource:
+			m.Addresses = append(m.Addresses, netip.AddrFrom16(body.AAAA).String())
+		}
+	}
+	slices.Sort(m.Addresses)
+	m.Addresses = slices.Compact(m.Addresses)
+	return m, ttl, true
+}
+
+// Zone
+
+// A zone is the set of DNS records published by the responder.
+type zone struct {
+	host     dnsmessage.Name
+	services []serviceRecords
+}
+
+func newZone(hostname string, services []Service) (z zone, errs []error) {
+	host, err := dnsmessage.NewName(hostname + "." + domain)
+	if err != nil {
+		return zone{}, []error{errors.Wrapf(err, "invalid hostname %s", hostname)}
+	}
+	z.host = host
+	for _, service := range services {
+		records, err := newServiceRecords(service, host)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		z.services = append(z.services, records)
+	}
+	return z, errs
+}
+
+// removed returns the records of services in the zone which aren't in the other zone.
+func (z zone) removed(other zone) []serviceRecords {
+	removed := make([]serviceRecords, 0)
+	for _, records := range z.services {
+		if !slices.ContainsFunc(other.services, func(o serviceRecords) bool {
+			return equalNames(o.srv.Header.Name, records.srv.Header.Name)
+		}) {
+			removed = append(removed, records)
+		}
+	}
+	return removed
+}
+
+// advertises checks whether the zone has a service with the specified service instance name.
+func (z zone) advertises(instance string) bool {
+	return slices.ContainsFunc(z.services, func(records serviceRecords) bool {
+		return strings.EqualFold(
+			strings.TrimSuffix(records.srv.Header.Name.String(), "."), strings.TrimSuffix(instance, "."),
+		)
+	})
+}
+
+// typesRecords returns the PTR records for DNS-SD service type enumeration.
+func (z zone) typesRecords() []dnsmessage.Resource {
+	types := make([]string, 0, len(z.services))
+	for _, records := range z.services {
+		if !slices.Contains(types, records.service.typeName()) {
+			types = append(types, records.service.typeName())
+		}
+	}
+	name := dnsmessage.MustNewName(servicesName)
+	resources := make([]dnsmessage.Resource, 0, len(types))
+	for _, t := range types {
+		resources = append(resources, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: otherTTL,
+			},
+			Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(t)},
+		})
+	}
+	return resources
+}
+
+// addressRecords returns the A and AAAA records for the host's addresses on the network interface.
+func (z zone) addressRecords(ifi *net.Interface) []dnsmessage.Resource {
+	if ifi == nil {
+		return nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	header := func(t dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{
+			Name: z.host, Type: t, Class: dnsmessage.ClassINET | cacheFlush, TTL: hostTTL,
+		}
+	}
+	resources := make([]dnsmessage.Resource, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			resources = append(resources, dnsmessage.Resource{
+				Header: header(dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte(ip4)},
+			})
+			continue
+		}
+		resources = append(resources, dnsmessage.Resource{
+			Header: header(dnsmessage.TypeAAAA),
+			Body:   &dnsmessage.AAAAResource{AAAA: [16]byte(ipNet.IP.To16())},
+		})
+	}
+	return resources
+}
+
+// answer returns the records in the zone which answer the question, as well as additional records
+// which the asker will probably need next (RFC 6763 Section 12).
+func (z zone) answer(
+	q dnsmessage.Question, addrs []dnsmessage.Resource,
+) (answers, additionals []dnsmessage.Resource) {
+	wants := func(t dnsmessage.Type) bool {
+		return q.Type == t || q.Type == dnsmessage.TypeALL
+	}
+	needsAddrs := false
+	if strings.EqualFold(q.Name.String(), servicesName) && wants(dnsmessage.TypePTR) {
+		answers = append(answers, z.typesRecords()...)
+	}
+	for _, records := range z.services {
+		for _, ptr := range records.ptrs {
+			if equalNames(ptr.Header.Name, q.Name) && wants(dnsmessage.TypePTR) {
+				answers = append(answers, ptr)
+				additionals = append(additionals, records.srv, records.txt)
+				needsAddrs = true
+			}
+		}
+		if !equalNames(records.srv.Header.Name, q.Name) {
+			continue
+		}
+		if wants(dnsmessage.TypeSRV) {
+			answers = append(answers, records.srv)
+			needsAddrs = true
+		}
+		if wants(dnsmessage.TypeTXT) {
+			answers = append(answers, records.txt)
+		}
+	}
+	if equalNames(z.host, q.Name) {
+		for _, addr := range addrs {
+			if wants(addr.Header.Type) {
+				answers = append(answers, addr)
+			}
+		}
+	} else if needsAddrs {
+		additionals = append(additionals, addrs...)
+	}
+	return answers, additionals
+}
+
+func equalNames(a, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
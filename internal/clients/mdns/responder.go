@@ -0,0 +1,332 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/openUC2/device-portal/internal/clients/apps"
+)
+
+const (
+	// announcements is the number of times services are announced after startup or changes, and
+	// announceInterval is the interval between announcements (RFC 6762 Section 8.3).
+	announcements    = 2
+	announceInterval = time.Second
+
+	// knownAnswerTTLDivisor determines the minimum remaining TTL (as a fraction of the record's full
+	// TTL) of a known answer in a query for the answer to be omitted from the response.
+	knownAnswerTTLDivisor = 2
+
+	// minReadBackoff and maxReadBackoff bound the delay before reading from an mDNS socket again after
+	// a read fails, so that persistent read errors don't make the responder spin.
+	minReadBackoff = 10 * time.Millisecond
+	maxReadBackoff = 5 * time.Second
+)
+
+// Serve answers mDNS queries for the advertised services until the context is canceled. Serve
+// announces the services on startup and whenever the app registry changes (or [Client.Refresh] is
+// called), and sends goodbye
+// announcements for services which are removed or when the context is canceled. Serve also
+// periodically browses for the device portals of other machines, for [Client.GetMachines].
+//
+// The responder doesn't probe for or resolve conflicts between names (RFC 6762 Section 8.1), since
+// service instance names include the machine name, which should be unique on the local network.
+func (c *Client) Serve(ctx context.Context) error {
+	if !c.Config.Enabled {
+		return nil
+	}
+	ifis, err := selectInterfaces(c.Config.Interfaces)
+	if err != nil {
+		return err
+	}
+	conns := c.listen(ifis)
+	if len(conns) == 0 {
+		return errors.New("couldn't listen for mDNS queries on any network interface")
+	}
+
+	c.updateZone()
+	eg, egctx := errgroup.WithContext(ctx)
+	for _, cn := range conns {
+		eg.Go(func() error {
+			return c.receive(egctx, cn)
+		})
+	}
+	eg.Go(func() error {
+		defer func() {
+			for _, cn := range conns {
+				if err := cn.close(); err != nil {
+					c.Logger.Error(errors.Wrap(err, "couldn't close mDNS socket"))
+				}
+			}
+		}()
+		return c.advertise(egctx, conns)
+	})
+	eg.Go(func() error {
+		return c.browse(egctx, conns)
+	})
+	return eg.Wait()
+}
+
+func (c *Client) listen(ifis []net.Interface) []conn {
+	var conns []conn
+	c4, errs := listenIPv4(ifis)
+	for _, err := range errs {
+		c.Logger.Warn(errors.Wrap(err, "couldn't set up mDNS over IPv4"))
+	}
+	if c4 != nil {
+		conns = append(conns, c4)
+	}
+	c6, errs := listenIPv6(ifis)
+	for _, err := range errs {
+		c.Logger.Warn(errors.Wrap(err, "couldn't set up mDNS over IPv6"))
+	}
+	if c6 != nil {
+		conns = append(conns, c6)
+	}
+	for _, cn := range conns {
+		names := make([]string, 0, len(cn.interfaces()))
+		for _, ifi := range cn.interfaces() {
+			names = append(names, ifi.Name)
+		}
+		c.Logger.Infof(
+			"advertising services over mDNS (%s) on %s", cn.group().IP, strings.Join(names, ", "),
+		)
+	}
+	return conns
+}
+
+// Announcements
+
+func (c *Client) advertise(ctx context.Context, conns []conn) error {
+	c.ac.Subscribe(ctx, func(_ apps.Registry) error {
+		c.Refresh()
+		return nil
+	})
+
+	z := c.getZone()
+	c.announce(ctx, conns, z)
+	for {
+		select {
+		case <-ctx.Done():
+			c.send(conns, z, z.services, true)
+			return nil
+		case <-c.changes:
+			prev := z
+			z = c.updateZone()
+			c.send(conns, prev, prev.removed(z), true)
+			c.announce(ctx, conns, z)
+		}
+	}
+}
+
+func (c *Client) announce(ctx context.Context, conns []conn, z zone) {
+	for i := range announcements {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(announceInterval):
+			}
+		}
+		c.send(conns, z, z.services, false)
+	}
+}
+
+// send sends unsolicited responses with the records of the specified services on all network
+// interfaces. If goodbye is true, the records are sent with zero TTL so that receivers will remove
+// them from their caches (RFC 6762 Section 10.1).
+func (c *Client) send(conns []conn, z zone, services []serviceRecords, goodbye bool) {
+	if len(services) == 0 {
+		return
+	}
+	for _, cn := range conns {
+		for _, ifi := range cn.interfaces() {
+			var addrs []dnsmessage.Resource
+			messages := make([][]dnsmessage.Resource, 0, len(services)+1)
+			if !goodbye {
+				addrs = z.addressRecords(&ifi)
+				messages = append(messages, z.typesRecords())
+			}
+			// We send a separate message for each service so that messages fit in a single packet
+			for _, records := range services {
+				answers := records.all()
+				if goodbye {
+					answers = withTTL(answers, 0)
+				}
+				messages = append(messages, answers)
+			}
+			for _, answers := range messages {
+				if err := c.write(cn, ifi.Index, cn.group(), dnsmessage.Message{
+					Header:      dnsmessage.Header{Response: true, Authoritative: true},
+					Answers:     answers,
+					Additionals: addrs,
+				}); err != nil {
+					c.Logger.Error(errors.Wrapf(err, "couldn't send mDNS announcement on %s", ifi.Name))
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) write(cn conn, ifIndex int, dst *net.UDPAddr, msg dnsmessage.Message) error {
+	packet, err := msg.Pack()
+	if err != nil {
+		return errors.Wrap(err, "couldn't pack mDNS message")
+	}
+	return errors.Wrapf(cn.write(packet, ifIndex, dst), "couldn't send mDNS message to %s", dst)
+}
+
+// Queries
+
+// receive handles mDNS packets from the socket until the socket is closed or the context is
+// canceled. After failed reads, receive waits with exponential backoff before reading again.
+func (c *Client) receive(ctx context.Context, cn conn) error {
+	packet := make([]byte, maxPacketSize)
+	var backoff time.Duration
+	for {
+		n, ifIndex, src, err := cn.read(packet)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			backoff = min(max(2*backoff, minReadBackoff), maxReadBackoff)
+			c.Logger.Error(errors.Wrapf(err, "couldn't receive mDNS packet (retrying in %s)", backoff))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		var p dnsmessage.Parser
+		h, err := p.Start(packet[:n])
+		if err != nil || h.OpCode != 0 {
+			continue // we only handle well-formed standard queries and responses
+		}
+		if h.Response {
+			if err := c.handleResponse(&p, src); err != nil {
+				c.Logger.Error(errors.Wrap(err, "couldn't handle mDNS response"))
+			}
+			continue
+		}
+		if err := c.respond(cn, &p, h, ifIndex, src); err != nil {
+			c.Logger.Error(errors.Wrap(err, "couldn't respond to mDNS query"))
+		}
+	}
+}
+
+func (c *Client) respond(
+	cn conn, p *dnsmessage.Parser, h dnsmessage.Header, ifIndex int, src *net.UDPAddr,
+) error {
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil
+	}
+	knownAnswers, err := p.AllAnswers()
+	if err != nil {
+		knownAnswers = nil
+	}
+
+	z := c.getZone()
+	var addrs []dnsmessage.Resource
+	if ifi, err := net.InterfaceByIndex(ifIndex); err == nil {
+		addrs = z.addressRecords(ifi)
+	}
+	var answers, additionals []dnsmessage.Resource
+	unicast := true
+	for _, q := range questions {
+		if q.Class&unicastResponse == 0 {
+			unicast = false
+		}
+		q.Class &^= unicastResponse
+		if q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY {
+			continue
+		}
+		qAnswers, qAdditionals := z.answer(q, addrs)
+		for _, answer := range qAnswers {
+			// Known-answer suppression is specified by RFC 6762 Section 7.1
+			if !containsRecord(knownAnswers, answer, answer.Header.TTL/knownAnswerTTLDivisor) {
+				answers = append(answers, answer)
+			}
+		}
+		additionals = append(additionals, qAdditionals...)
+	}
+	answers = dedupeRecords(answers, nil)
+	if len(answers) == 0 {
+		return nil
+	}
+	additionals = dedupeRecords(additionals, answers)
+
+	msg := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	dst := cn.group()
+	switch {
+	case src == nil:
+	case src.Port != port:
+		// This is a legacy unicast query (RFC 6762 Section 6.7), e.g. from a conventional DNS resolver
+		msg.Header.ID = h.ID
+		msg.Questions = questions
+		msg.Answers = forLegacyUnicast(answers)
+		msg.Additionals = forLegacyUnicast(additionals)
+		dst = src
+	case unicast:
+		dst = src
+	}
+	return c.write(cn, ifIndex, dst, msg)
+}
+
+// Records
+
+func sameRecord(a, b dnsmessage.Resource) bool {
+	return equalNames(a.Header.Name, b.Header.Name) && a.Header.Type == b.Header.Type &&
+		a.Body.GoString() == b.Body.GoString()
+}
+
+// containsRecord checks whether the records include the record with a TTL of at least minTTL.
+func containsRecord(records []dnsmessage.Resource, record dnsmessage.Resource, minTTL uint32) bool {
+	return slices.ContainsFunc(records, func(r dnsmessage.Resource) bool {
+		return sameRecord(r, record) && r.Header.TTL >= minTTL
+	})
+}
+
+// dedupeRecords returns the records without duplicates and without any excluded records.
+func dedupeRecords(records, excluded []dnsmessage.Resource) []dnsmessage.Resource {
+	deduped := make([]dnsmessage.Resource, 0, len(records))
+	for _, record := range records {
+		if containsRecord(deduped, record, 0) || containsRecord(excluded, record, 0) {
+			continue
+		}
+		deduped = append(deduped, record)
+	}
+	return deduped
+}
+
+func withTTL(records []dnsmessage.Resource, ttl uint32) []dnsmessage.Resource {
+	updated := slices.Clone(records)
+	for i := range updated {
+		updated[i].Header.TTL = ttl
+	}
+	return updated
+}
+
+// forLegacyUnicast adjusts records for responses to legacy unicast queries, as specified by RFC
+// 6762 Section 6.7.
+func forLegacyUnicast(records []dnsmessage.Resource) []dnsmessage.Resource {
+	updated := slices.Clone(records)
+	for i := range updated {
+		updated[i].Header.TTL = min(updated[i].Header.TTL, legacyTTL)
+		updated[i].Header.Class &^= cacheFlush
+	}
+	return updated
+}
@@ -0,0 +1,299 @@
+package mdns
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeConn is a conn which reads queued packets (or a read error, once the queue is empty), and
+// which records written packets.
+type fakeConn struct {
+	packets []fakePacket
+	readErr error
+
+	mu      sync.Mutex
+	reads   int
+	written []fakePacket
+}
+
+type fakePacket struct {
+	data    []byte
+	ifIndex int
+	addr    *net.UDPAddr
+}
+
+func (c *fakeConn) read(b []byte) (n, ifIndex int, src *net.UDPAddr, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reads++
+	if len(c.packets) == 0 {
+		return 0, 0, nil, c.readErr
+	}
+	packet := c.packets[0]
+	c.packets = c.packets[1:]
+	return copy(b, packet.data), packet.ifIndex, packet.addr, nil
+}
+
+func (c *fakeConn) write(b []byte, ifIndex int, dst *net.UDPAddr) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.written = append(c.written, fakePacket{data: b, ifIndex: ifIndex, addr: dst})
+	return nil
+}
+
+func (c *fakeConn) group() *net.UDPAddr {
+	return groupIPv4
+}
+
+func (c *fakeConn) interfaces() []net.Interface {
+	return []net.Interface{{Index: 1, Name: "test0"}}
+}
+
+func (c *fakeConn) close() error {
+	return nil
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	z, errs := newZone("openuc2-test", []Service{{
+		Instance: "Machine test",
+		Type:     ServiceType,
+		Subtypes: []string{PortalSubtype},
+		Port:     80,
+		TXT:      []string{"path=/"},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("couldn't make zone: %s", errs)
+	}
+	logger := log.New("mdns")
+	logger.SetOutput(io.Discard)
+	return &Client{Logger: logger, zone: z}
+}
+
+func packQuery(
+	t *testing.T, id uint16, questions []dnsmessage.Question, knownAnswers []dnsmessage.Resource,
+) []byte {
+	t.Helper()
+	packet, err := (&dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id}, Questions: questions, Answers: knownAnswers,
+	}).Pack()
+	if err != nil {
+		t.Fatalf("couldn't pack query: %s", err)
+	}
+	return packet
+}
+
+func TestRespond(t *testing.T) {
+	t.Parallel()
+	ptrName := dnsmessage.MustNewName(ServiceType + "." + domain)
+	ptrQuestion := dnsmessage.Question{
+		Name: ptrName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET,
+	}
+	multicastSrc := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: port}
+	legacySrc := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 49152}
+	ptrAnswer := func(c *Client) dnsmessage.Resource {
+		return c.zone.services[0].ptrs[0]
+	}
+	for _, tc := range []struct {
+		name         string
+		id           uint16
+		questions    []dnsmessage.Question
+		knownAnswers func(c *Client) []dnsmessage.Resource
+		src          *net.UDPAddr
+		// dst is the expected destination of the response, or nil if no response is expected
+		dst    *net.UDPAddr
+		legacy bool
+	}{
+		{
+			name:      "multicast",
+			questions: []dnsmessage.Question{ptrQuestion},
+			src:       multicastSrc,
+			dst:       groupIPv4,
+		},
+		{
+			name: "unicast response",
+			questions: []dnsmessage.Question{{
+				Name: ptrName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET | unicastResponse,
+			}},
+			src: multicastSrc,
+			dst: multicastSrc,
+		},
+		{
+			name: "unknown name",
+			questions: []dnsmessage.Question{{
+				Name:  dnsmessage.MustNewName("_ipp._tcp.local."),
+				Type:  dnsmessage.TypePTR,
+				Class: dnsmessage.ClassINET,
+			}},
+			src: multicastSrc,
+		},
+		{
+			name:      "known answer",
+			questions: []dnsmessage.Question{ptrQuestion},
+			knownAnswers: func(c *Client) []dnsmessage.Resource {
+				return []dnsmessage.Resource{ptrAnswer(c)}
+			},
+			src: multicastSrc,
+		},
+		{
+			name:      "expiring known answer",
+			questions: []dnsmessage.Question{ptrQuestion},
+			knownAnswers: func(c *Client) []dnsmessage.Resource {
+				return withTTL([]dnsmessage.Resource{ptrAnswer(c)}, otherTTL/knownAnswerTTLDivisor-1)
+			},
+			src: multicastSrc,
+			dst: groupIPv4,
+		},
+		{
+			name:      "legacy unicast",
+			id:        1234,
+			questions: []dnsmessage.Question{ptrQuestion},
+			src:       legacySrc,
+			dst:       legacySrc,
+			legacy:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := newTestClient(t)
+			var knownAnswers []dnsmessage.Resource
+			if tc.knownAnswers != nil {
+				knownAnswers = tc.knownAnswers(c)
+			}
+			cn := &fakeConn{
+				packets: []fakePacket{{
+					data: packQuery(t, tc.id, tc.questions, knownAnswers), addr: tc.src,
+				}},
+				readErr: net.ErrClosed,
+			}
+			if err := c.receive(t.Context(), cn); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if tc.dst == nil {
+				if len(cn.written) > 0 {
+					t.Fatalf("got %d responses, expected none", len(cn.written))
+				}
+				return
+			}
+			if len(cn.written) != 1 {
+				t.Fatalf("got %d responses, expected 1", len(cn.written))
+			}
+			if dst := cn.written[0].addr; dst.String() != tc.dst.String() {
+				t.Errorf("got response to %s, expected %s", dst, tc.dst)
+			}
+			var response dnsmessage.Message
+			if err := response.Unpack(cn.written[0].data); err != nil {
+				t.Fatalf("couldn't unpack response: %s", err)
+			}
+			if !response.Response || !response.Authoritative {
+				t.Errorf("response isn't an authoritative response: %+v", response.Header)
+			}
+			if len(response.Answers) != 1 || !sameRecord(response.Answers[0], ptrAnswer(c)) {
+				t.Fatalf("got answers %+v, expected %+v", response.Answers, ptrAnswer(c))
+			}
+			if len(response.Additionals) == 0 {
+				t.Errorf("response has no additional records")
+			}
+			checkLegacyResponse(t, response, tc.id, tc.legacy)
+		})
+	}
+}
+
+// checkLegacyResponse checks whether the response to a query with the specified ID was adjusted
+// for legacy unicast queries (RFC 6762 Section 6.7) if and only if legacy is true.
+func checkLegacyResponse(t *testing.T, response dnsmessage.Message, id uint16, legacy bool) {
+	t.Helper()
+	if !legacy {
+		if len(response.Questions) > 0 {
+			t.Errorf("got questions %+v, expected none", response.Questions)
+		}
+		if ttl := response.Answers[0].Header.TTL; ttl != otherTTL {
+			t.Errorf("got answer TTL %d, expected %d", ttl, otherTTL)
+		}
+		return
+	}
+	if response.ID != id {
+		t.Errorf("got ID %d, expected %d", response.ID, id)
+	}
+	if len(response.Questions) != 1 {
+		t.Errorf("got questions %+v, expected the query's question", response.Questions)
+	}
+	for _, record := range append(response.Answers, response.Additionals...) {
+		if record.Header.TTL > legacyTTL {
+			t.Errorf(
+				"got TTL %d for %s, expected at most %d", record.Header.TTL, record.Header.Name, legacyTTL,
+			)
+		}
+		if record.Header.Class&cacheFlush != 0 {
+			t.Errorf("record %s has the cache-flush bit", record.Header.Name)
+		}
+	}
+}
+
+func TestGoodbye(t *testing.T) {
+	t.Parallel()
+	c := newTestClient(t)
+	cn := &fakeConn{}
+	z := c.getZone()
+	c.send([]conn{cn}, z, z.services, true)
+
+	if len(cn.written) != len(z.services) {
+		t.Fatalf("got %d messages, expected %d", len(cn.written), len(z.services))
+	}
+	for _, packet := range cn.written {
+		if packet.addr != groupIPv4 || packet.ifIndex != 1 {
+			t.Errorf(
+				"got message to %s on interface %d, expected %s on interface 1",
+				packet.addr, packet.ifIndex, groupIPv4,
+			)
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(packet.data); err != nil {
+			t.Fatalf("couldn't unpack message: %s", err)
+		}
+		if len(msg.Answers) != len(z.services[0].all()) {
+			t.Errorf("got %d records, expected %d", len(msg.Answers), len(z.services[0].all()))
+		}
+		for _, record := range msg.Answers {
+			if record.Header.TTL != 0 {
+				t.Errorf("got TTL %d for %s, expected 0", record.Header.TTL, record.Header.Name)
+			}
+		}
+		if len(msg.Additionals) > 0 {
+			t.Errorf("got additional records %+v, expected none", msg.Additionals)
+		}
+	}
+}
+
+func TestReceiveBackoff(t *testing.T) {
+	t.Parallel()
+	c := newTestClient(t)
+	cn := &fakeConn{readErr: errors.New("network is down")}
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.receive(ctx, cn); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("receive took %s to stop after the context was canceled", elapsed)
+	}
+	// With exponential backoff starting from minReadBackoff, only a few reads fit in the timeout
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.reads > 10 {
+		t.Errorf("got %d reads after read errors, expected at most 10", cn.reads)
+	}
+}
@@ -1,25 +1,214 @@
-// Package templates provides a path for webpage templates to be lazily loaded from the filesystem.
+// Package templates loads webpage templates from a stack of paths in the filesystem, keeping the
+// last templates which passed validation so that broken edits of templates don't take down pages.
 package templates
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest"
+
+	"github.com/openUC2/device-portal/internal/overlayfs"
 )
 
 type Client struct {
+	// Config should only be changed with the Reconfigure method.
 	Config Config
+	Logger godest.Logger
+	// Validate checks templates loaded from the templates paths (with a layer for each path) before
+	// they replace the current templates. If it's nil, templates aren't checked.
+	Validate func(paths []string, layers []fs.FS) error
+
+	// loadMu serializes loads, so that templates loaded earlier can't replace templates loaded later.
+	loadMu sync.Mutex
+	mu     sync.RWMutex
+	// layers are in-memory copies of the templates paths, from the last templates which were loaded
+	// and passed validation.
+	layers []fs.FS
+	// digest summarizes the contents of layers, so that reloads without changes can be skipped.
+	digest string
+
+	reconfigured chan struct{}
 }
 
-func NewClient(c Config) *Client {
+func NewClient(c Config, l godest.Logger) *Client {
 	return &Client{
-		Config: c,
+		Config:       c,
+		Logger:       l,
+		reconfigured: make(chan struct{}, 1),
 	}
 }
 
-func (c *Client) GetFS() fs.FS {
-	path := c.Config.Path
-	if path == "" {
+// Reconfigure changes the client's config, e.g. when the config is reloaded, and then reloads the
+// templates from the new templates paths.
+func (c *Client) Reconfigure(config Config) {
+	c.mu.Lock()
+	c.Config = config
+	c.mu.Unlock()
+
+	c.reload()
+	select {
+	case c.reconfigured <- struct{}{}:
+	default: // the watcher already has a pending notification
+	}
+}
+
+func (c *Client) getConfig() Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.Config
+}
+
+func (c *Client) getLayers() []fs.FS {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.layers
+}
+
+// Load loads the templates from the templates paths and validates them. If they're valid, they
+// replace the current templates for all later renders; otherwise, the current templates are kept.
+func (c *Client) Load() error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	paths := c.getConfig().Paths
+	layers, digest, err := loadLayers(paths)
+	if err != nil {
+		return errors.Wrap(err, "couldn't load templates")
+	}
+	if digest == c.getDigest() {
 		return nil
 	}
-	return os.DirFS(path)
+	if c.Validate != nil && len(paths) > 0 {
+		if err = c.Validate(paths, layers); err != nil {
+			return errors.Wrap(err, "templates are invalid")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.layers = layers
+	c.digest = digest
+	if len(paths) > 0 {
+		c.Logger.Infof("loaded templates from %s", strings.Join(paths, string(filepath.ListSeparator)))
+	}
+	return nil
+}
+
+func (c *Client) getDigest() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.digest
+}
+
+// reload calls Load and logs any error, since the current templates are still usable.
+func (c *Client) reload() {
+	if err := c.Load(); err != nil {
+		c.Logger.Error(errors.Wrap(err, "couldn't reload templates, so the last good templates are kept"))
+	}
+}
+
+// loadLayers copies the files in each templates path into memory, returning a layer for each path
+// and a digest of their contents. Missing templates paths are treated as empty.
+func loadLayers(paths []string) (layers []fs.FS, digest string, err error) {
+	h := sha256.New()
+	for i, path := range paths {
+		dir := os.DirFS(path)
+		layer := make(fstest.MapFS)
+		if err = fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+			if name == "." && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := fs.Stat(dir, name) // follows symlinks
+			if err != nil {
+				return errors.Wrapf(err, "couldn't stat %s", name)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			contents, err := fs.ReadFile(dir, name)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't read %s", name)
+			}
+			layer[name] = &fstest.MapFile{Data: contents, ModTime: info.ModTime()}
+			_, _ = fmt.Fprintf(h, "%d %s %x\n", i, name, sha256.Sum256(contents))
+			return nil
+		}); err != nil {
+			return nil, "", errors.Wrapf(err, "couldn't load templates from %s", path)
+		}
+		layers = append(layers, layer)
+	}
+	return layers, fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// GetFS returns a filesystem which loads files from the current templates (with files in earlier
+// templates paths overriding files in later paths), or which has no files if no templates paths are
+// configured. The filesystem follows changes to the current templates.
+func (c *Client) GetFS() fs.FS {
+	return templatesFS{c: c}
+}
+
+// templatesFS is an [fs.FS] which loads files from the client's current templates.
+type templatesFS struct {
+	c *Client
+}
+
+func (f templatesFS) dir(op, name string) (*overlayfs.FS, error) {
+	layers := f.StackLayers()
+	if len(layers) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return overlayfs.New(layers...), nil
+}
+
+// StackLayers returns a filesystem for each of the client's current templates paths, so that an
+// [overlayfs.FS] with templatesFS as a layer applies whiteouts in the templates paths to its lower
+// layers.
+func (f templatesFS) StackLayers() []fs.FS {
+	return f.c.getLayers()
+}
+
+func (f templatesFS) Open(name string) (fs.File, error) {
+	dir, err := f.dir("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return dir.Open(name)
+}
+
+func (f templatesFS) ReadFile(name string) ([]byte, error) {
+	dir, err := f.dir("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return dir.ReadFile(name)
+}
+
+func (f templatesFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, err := f.dir("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return dir.ReadDir(name)
+}
+
+func (f templatesFS) Stat(name string) (fs.FileInfo, error) {
+	dir, err := f.dir("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return dir.Stat(name)
 }
@@ -1,19 +1,74 @@
 package templates
 
 import (
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
 	"github.com/sargassum-world/godest/env"
 )
 
 const envPrefix = "TEMPLATES_"
 
+// WatchMode determines how the templates paths are watched for changes.
+type WatchMode string
+
+const (
+	// WatchModeNotify watches the templates paths with filesystem notifications (e.g. inotify on
+	// Linux), falling back to polling if filesystem notifications are unavailable.
+	WatchModeNotify WatchMode = "notify"
+	// WatchModePoll periodically re-scans the templates paths.
+	WatchModePoll WatchMode = "poll"
+	// WatchModeNone disables watching, so that changes are only loaded after the config is reloaded
+	// or after a restart.
+	WatchModeNone WatchMode = "none"
+)
+
 type Config struct {
-	Path string
+	// Paths are the directories of custom templates, from the highest priority to the lowest
+	// priority; templates in each directory override templates at the same paths in the directories
+	// after it.
+	Paths []string
+
+	WatchMode    WatchMode
+	PollInterval time.Duration
 }
 
+// Default values of templates settings.
+const (
+	// DefaultPath is empty, so that only the built-in templates are used.
+	DefaultPath         = ""
+	DefaultWatchMode    = WatchModeNotify
+	DefaultPollInterval = "5s"
+)
+
 func GetConfig() (c Config, err error) {
-	// This is a file path specific to ImSwitch OS
-	const defaultPath = ""
-	c.Path = env.GetString(envPrefix+"PATH", defaultPath)
+	c.Paths = ParsePaths(env.GetString(envPrefix+"PATH", DefaultPath))
+
+	c.WatchMode = WatchMode(env.GetString(envPrefix+"WATCH", string(DefaultWatchMode)))
+	switch c.WatchMode {
+	default:
+		return Config{}, errors.Errorf(
+			"unknown watch mode %s (must be one of: %s, %s, %s)",
+			c.WatchMode, WatchModeNotify, WatchModePoll, WatchModeNone,
+		)
+	case WatchModeNotify, WatchModePoll, WatchModeNone:
+	}
 
+	rawPollInterval := env.GetString(envPrefix+"POLLINTERVAL", DefaultPollInterval)
+	if c.PollInterval, err = time.ParseDuration(rawPollInterval); err != nil {
+		return Config{}, errors.Wrap(err, "couldn't make poll interval config")
+	}
 	return c, nil
 }
+
+// ParsePaths splits a list of directories separated by the OS-specific path list separator (e.g. a
+// colon on Linux), ignoring empty elements.
+func ParsePaths(raw string) (paths []string) {
+	for _, path := range filepath.SplitList(raw) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
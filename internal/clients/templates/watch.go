@@ -0,0 +1,193 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sargassum-world/godest/handling"
+)
+
+// watchDebounce is how long to wait for filesystem changes to settle before reloading the
+// templates, since editors and deployment tools often write several files at once.
+const watchDebounce = 500 * time.Millisecond
+
+// Watch watches the templates paths for changes until the context is canceled. After each change,
+// Watch reloads the templates; if the changed templates are invalid, the error is logged and the
+// last good templates are kept.
+func (c *Client) Watch(ctx context.Context) error {
+	config := c.getConfig()
+	switch config.WatchMode {
+	default:
+		return errors.Errorf("unknown watch mode %s", config.WatchMode)
+	case WatchModeNone:
+		return nil
+	case WatchModePoll:
+		return c.watchPolling(ctx, config.PollInterval)
+	case WatchModeNotify:
+		err := c.watchNotifications(ctx)
+		if err == nil || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		c.Logger.Warn(errors.Wrap(err, "falling back to polling for changes to templates"))
+		return c.watchPolling(ctx, config.PollInterval)
+	}
+}
+
+// Filesystem notifications
+
+func (c *Client) watchNotifications(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "couldn't start filesystem watcher")
+	}
+	defer func() {
+		if err := watcher.Close(); err != nil {
+			c.Logger.Error(errors.Wrap(err, "couldn't stop filesystem watcher"))
+		}
+	}()
+
+	paths := cleanPaths(c.getConfig().Paths)
+	if err = syncWatches(watcher, paths); err != nil {
+		return err
+	}
+	if len(paths) > 0 {
+		c.Logger.Infof(
+			"watching %s for changes to templates", strings.Join(paths, string(filepath.ListSeparator)),
+		)
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.reconfigured:
+			paths = cleanPaths(c.getConfig().Paths)
+			if err := syncWatches(watcher, paths); err != nil {
+				c.Logger.Error(err)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			c.Logger.Error(errors.Wrap(err, "filesystem watcher for templates reported an error"))
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if affectsTemplates(paths, event) {
+				debounce.Reset(watchDebounce)
+			}
+		case <-debounce.C:
+			// Directories may have been created or removed in the templates paths
+			if err := syncWatches(watcher, paths); err != nil {
+				c.Logger.Error(err)
+			}
+			c.reload()
+		}
+	}
+}
+
+func cleanPaths(paths []string) []string {
+	cleaned := make([]string, 0, len(paths))
+	for _, path := range paths {
+		cleaned = append(cleaned, filepath.Clean(path))
+	}
+	return cleaned
+}
+
+// syncWatches makes the watcher watch every directory in the templates paths, since filesystem
+// notifications aren't recursive. It also watches the parent directory of each templates path, so
+// that it notices when the templates path is created, removed, or replaced (e.g. by a symlink to a
+// different directory).
+func syncWatches(watcher *fsnotify.Watcher, paths []string) error {
+	dirs := make(map[string]bool)
+	for _, path := range paths {
+		dirs[filepath.Dir(path)] = true
+		_ = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				dirs[name] = true
+			}
+			return nil // directories which can't be read are skipped
+		})
+	}
+	for _, dir := range watcher.WatchList() {
+		if !dirs[dir] {
+			// The directory may have already been removed, which also removes the watch
+			_ = watcher.Remove(dir)
+		}
+	}
+	watched := make(map[string]bool)
+	for _, dir := range watcher.WatchList() {
+		watched[dir] = true
+	}
+	for dir := range dirs {
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "couldn't watch %s", dir)
+		}
+	}
+	return nil
+}
+
+func affectsTemplates(paths []string, event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return false
+	}
+	for _, path := range paths {
+		if event.Name == path || strings.HasPrefix(event.Name, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false // this is an unrelated file in a parent directory
+}
+
+// Polling
+
+func (c *Client) watchPolling(ctx context.Context, interval time.Duration) error {
+	c.Logger.Infof("polling templates paths every %s for changes to templates", interval)
+	prevFingerprint := fingerprintFiles(c.getConfig().Paths)
+	return handling.Except(
+		handling.Repeat(ctx, interval, func() (done bool, err error) {
+			fingerprint := fingerprintFiles(c.getConfig().Paths)
+			if fingerprint != prevFingerprint {
+				prevFingerprint = fingerprint
+				c.reload()
+			}
+			return false, nil
+		}),
+		context.Canceled,
+	)
+}
+
+// fingerprintFiles summarizes the names, sizes, and modification times of all files in the
+// templates paths, so that changes to templates can be detected by comparing fingerprints.
+func fingerprintFiles(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s\n", path)
+		_ = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil // files which can't be read are skipped
+			}
+			info, err := os.Stat(name) // follows symlinks
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(&b, "%s:%d:%d\n", name, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return b.String()
+}
@@ -0,0 +1,599 @@
+// Package overlayfs provides a union filesystem which combines an ordered stack of filesystems, so
+// that files in higher layers override files at the same paths in lower layers
+package overlayfs
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"io/fs"
+	"iter"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FS
+
+// An FS is a [fs.FS] constructed by stacking a list of [fs.FS] layers, where each file is read from
+// the highest layer which has a file at its path. Directories are merged across all layers. Layers
+// can hide files in lower layers with whiteout files and opaque directory markers, in the same way
+// as the layers of OCI container images:
+//
+//   - A whiteout file named [WhiteoutPrefix] followed by the name of a file or directory (e.g.
+//     "home/.wh.index.page.tmpl") hides that file or directory in all lower layers.
+//   - An opaque directory marker file named [OpaqueMarker] in a directory hides the contents of
+//     that directory in all lower layers.
+//
+// A non-directory file also hides everything under its path in lower layers, e.g. a file named
+// "home" hides a directory named "home" in lower layers. Whiteout files and opaque directory
+// markers are never listed or opened as files of the FS. As with other implementations of [fs.FS],
+// names must satisfy [fs.ValidPath].
+type FS struct {
+	// Layers are the filesystems in the stack, from the highest layer to the lowest layer. Nil
+	// layers are ignored.
+	Layers []fs.FS
+}
+
+// New makes an FS from the layers, which are ordered from the highest layer to the lowest layer.
+func New(layers ...fs.FS) *FS {
+	return &FS{Layers: layers}
+}
+
+// DirLayers makes a layer for each directory of the host operating system, in the same order as the
+// directories.
+func DirLayers(dirs []string) []fs.FS {
+	layers := make([]fs.FS, 0, len(dirs))
+	for _, dir := range dirs {
+		layers = append(layers, os.DirFS(dir))
+	}
+	return layers
+}
+
+// A Stack is a [fs.FS] made of layers, such as an [FS]. When an FS has a Stack as a layer, it uses
+// the layers of the Stack in its place, so that whiteouts in the Stack's layers also hide files in
+// the FS's lower layers.
+type Stack interface {
+	fs.FS
+	// StackLayers returns the layers of the Stack, from the highest layer to the lowest layer.
+	StackLayers() []fs.FS
+}
+
+// StackLayers returns the layers of the FS, with the layers of each [Stack] layer in its place.
+func (f *FS) StackLayers() []fs.FS {
+	layers := make([]fs.FS, 0, len(f.Layers))
+	for _, layer := range f.Layers {
+		if stack, ok := layer.(Stack); ok {
+			layers = append(layers, stack.StackLayers()...)
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// Whiteouts
+
+const (
+	// WhiteoutPrefix is the prefix of the names of whiteout files.
+	WhiteoutPrefix = ".wh."
+	// OpaqueMarker is the name of opaque directory marker files.
+	OpaqueMarker = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// isWhiteout checks whether the named file is a whiteout file or an opaque directory marker.
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), WhiteoutPrefix)
+}
+
+// hides checks whether the layer hides the named file in lower layers, with a whiteout file for the
+// file or for one of its parent directories, with an opaque directory marker in one of its parent
+// directories, or with a non-directory file at the path of one of its parent directories.
+func hides(layer fs.FS, name string) (bool, error) {
+	if name == "." {
+		return false, nil
+	}
+	dir := "."
+	for element := range strings.SplitSeq(name, "/") {
+		for _, marker := range []string{
+			path.Join(dir, OpaqueMarker), path.Join(dir, WhiteoutPrefix+element),
+		} {
+			_, err := fs.Stat(layer, marker)
+			if err == nil {
+				return true, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return false, errors.Wrapf(err, "couldn't stat %s", marker)
+			}
+		}
+
+		// Markers can only be in directories which exist in the layer
+		dir = path.Join(dir, element)
+		if dir == name {
+			break
+		}
+		info, err := fs.Stat(layer, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "couldn't stat %s", dir)
+		}
+		if !info.IsDir() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fileAt checks whether the layer has a non-directory file at the named path or at the path of one
+// of its parent directories.
+func fileAt(layer fs.FS, name string) (bool, error) {
+	if name == "." {
+		return false, nil
+	}
+	dir := "."
+	for element := range strings.SplitSeq(name, "/") {
+		dir = path.Join(dir, element)
+		info, err := fs.Stat(layer, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "couldn't stat %s", dir)
+		}
+		if !info.IsDir() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// notExist checks whether an error from reading the named file from the layer means that the layer
+// doesn't have the file. Some filesystems (e.g. [os.DirFS]) report a different error than
+// [fs.ErrNotExist] if one of the file's parent directories is a non-directory file.
+func notExist(layer fs.FS, name string, err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	file, fileErr := fileAt(layer, path.Dir(name))
+	return fileErr == nil && file
+}
+
+// find calls read on each layer of the FS, from the highest layer to the lowest layer, until read
+// finds the named file or a layer hides the file from lower layers.
+func find[Result any](
+	f *FS, op, name string, read func(layer fs.FS, name string) (Result, error),
+) (result Result, err error) {
+	if !fs.ValidPath(name) {
+		return result, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if isWhiteout(name) {
+		return result, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	for i, layer := range f.StackLayers() {
+		if layer == nil {
+			continue
+		}
+		if result, err = read(layer, name); err == nil {
+			return result, nil
+		}
+		if !notExist(layer, name, err) {
+			return result, &fs.PathError{
+				Op:   op,
+				Path: name,
+				Err:  errors.Wrapf(err, "couldn't %s file %s in layer %d", op, name, i),
+			}
+		}
+		hidden, err := hides(layer, name)
+		if err != nil {
+			return result, &fs.PathError{
+				Op:   op,
+				Path: name,
+				Err:  errors.Wrapf(err, "couldn't check for whiteouts of %s in layer %d", name, i),
+			}
+		}
+		if hidden {
+			break
+		}
+	}
+	return result, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// FS: fs.FS
+
+// Open opens the named file from the highest layer which has it. If the file is a directory, its
+// entries are merged across layers in the same way as by [FS.ReadDir], so that entries hidden by
+// whiteouts, as well as the whiteouts themselves, aren't listed.
+func (f *FS) Open(name string) (fs.File, error) {
+	file, err := find(f, "open", name, func(layer fs.FS, name string) (fs.File, error) {
+		return layer.Open(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, &fs.PathError{
+			Op: "open", Path: name, Err: errors.Wrapf(err, "couldn't stat %s", name),
+		}
+	}
+	if !info.IsDir() {
+		return file, nil
+	}
+	return &dirFile{File: file, f: f, name: name}, nil
+}
+
+// Sub returns an FS corresponding to the subtree rooted at dir. The layers of [Stack] layers are
+// determined when Sub is called.
+func (f *FS) Sub(dir string) (*FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+	layers := f.StackLayers()
+	sub := &FS{Layers: make([]fs.FS, len(layers))}
+	for i, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		hidden, err := hides(layer, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't check for whiteouts of %s in layer %d", dir, i)
+		}
+		file, err := fileAt(layer, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't check for files at %s in layer %d", dir, i)
+		}
+		if file {
+			break // the layer has no subtree at dir, and it hides the subtrees in lower layers
+		}
+		if sub.Layers[i], err = fs.Sub(layer, dir); err != nil {
+			return nil, errors.Wrapf(err, "couldn't make subtree for layer %d", i)
+		}
+		if hidden {
+			break
+		}
+	}
+	return sub, nil
+}
+
+// FS: fs.ReadDirFS
+
+// ReadDir reads the named directory from all layers which have it (down to the first layer which
+// hides it or makes it opaque), and returns a list of directory entries sorted by filename. Each
+// entry is from the highest layer which has an entry with its name.
+func (f *FS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	if isWhiteout(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	entryNames := make(Set[string])
+	whiteouts := make(Set[string]) // entries hidden by higher layers
+	found := false
+	for i, layer := range f.StackLayers() {
+		if layer == nil {
+			continue
+		}
+		layerEntries, err := readLayerDir(layer, name, i)
+		if err != nil {
+			return nil, err
+		}
+		found = found || layerEntries != nil
+		layerWhiteouts := make(Set[string])
+		opaque := false
+		for _, entry := range layerEntries {
+			switch entryName := entry.Name(); {
+			case entryName == OpaqueMarker:
+				opaque = true
+			case strings.HasPrefix(entryName, WhiteoutPrefix):
+				layerWhiteouts.Add(strings.TrimPrefix(entryName, WhiteoutPrefix))
+			case !entryNames.Has(entryName) && !whiteouts.Has(entryName):
+				entries = append(entries, entry)
+				entryNames.Add(entryName)
+			}
+		}
+		if opaque {
+			break
+		}
+		whiteouts.Add(slices.Collect(layerWhiteouts.All())...)
+
+		hidden, err := hides(layer, name)
+		if err != nil {
+			return nil, &fs.PathError{
+				Op:   "read",
+				Path: name,
+				Err:  errors.Wrapf(err, "couldn't check for whiteouts of %s in layer %d", name, i),
+			}
+		}
+		if hidden {
+			break
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return cmp.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// readLayerDir reads the named directory from the layer with index i, returning nil entries if the
+// layer doesn't have the directory.
+func readLayerDir(layer fs.FS, name string, i int) ([]fs.DirEntry, error) {
+	info, err := fs.Stat(layer, name)
+	if err != nil && notExist(layer, name, err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &fs.PathError{
+			Op:   "read",
+			Path: name,
+			Err:  errors.Wrapf(err, "couldn't stat %s in layer %d", name, i),
+		}
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{
+			Op:   "read",
+			Path: name,
+			Err:  errors.Errorf("%s is a non-directory file in layer %d", name, i),
+		}
+	}
+	entries, err := fs.ReadDir(layer, name)
+	if err != nil {
+		return nil, &fs.PathError{
+			Op:   "read",
+			Path: name,
+			Err:  errors.Wrapf(err, "couldn't read directory %s in layer %d", name, i),
+		}
+	}
+	if entries == nil {
+		// Distinguish an empty directory from a missing directory
+		entries = []fs.DirEntry{}
+	}
+	return entries, nil
+}
+
+// dirFile is a directory opened from an [FS]. It's read from the highest layer which has the
+// directory, except that its entries are read from all layers by [FS.ReadDir].
+type dirFile struct {
+	fs.File
+	f       *FS
+	name    string
+	entries []fs.DirEntry
+	loaded  bool
+	offset  int
+}
+
+// ReadDir reads the next n entries of the directory, or all remaining entries if n <= 0, in the
+// same way as [fs.ReadDirFile].
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.f.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// FS: fs.ReadFileFS
+
+// ReadFile returns the contents from reading the named file from the highest layer which has it.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	return find(f, "read", name, fs.ReadFile)
+}
+
+// FS: fs.StatFS
+
+// Stat returns a [fs.FileInfo] describing the file from the highest layer which has it.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return find(f, "stat", name, fs.Stat)
+}
+
+// FS: layer comparison
+
+// A Layering describes how a file in the upper layers of an [FS] (i.e. all layers except the
+// lowest layer) relates to the lowest layer.
+type Layering string
+
+const (
+	// LayeringAdded means that the file is only in the upper layers.
+	LayeringAdded Layering = "added"
+	// LayeringShadowed means that the file is in the upper layers and in the lowest layer with
+	// different contents (or the lowest layer has a directory at its path), so the file in the
+	// upper layers shadows the file in the lowest layer.
+	LayeringShadowed Layering = "shadowed"
+	// LayeringIdentical means that the file is in the upper layers and in the lowest layer with the
+	// same contents.
+	LayeringIdentical Layering = "identical"
+	// LayeringInherited means that the file is only in the lowest layer.
+	LayeringInherited Layering = "inherited"
+	// LayeringHidden means that the file is in the lowest layer, but it's hidden by a whiteout in
+	// the upper layers.
+	LayeringHidden Layering = "hidden"
+)
+
+// A LayeredFile is a file in an [FS], with a description of which layers it's in.
+type LayeredFile struct {
+	Path string
+	// Layer is the index (in the FS's StackLayers) of the highest layer which has the file, or of
+	// the layer which hides the file if the file is hidden.
+	Layer    int
+	Layering Layering
+}
+
+// Compare walks all files in the FS and describes how the files in its upper layers relate to its
+// lowest layer (e.g. custom files over built-in files), in lexical order of their paths. Files in
+// the lowest layer which are hidden by the upper layers are also described.
+func (f *FS) Compare() (files []LayeredFile, err error) {
+	layers := f.StackLayers()
+	if len(layers) == 0 {
+		return nil, nil
+	}
+	if err = fs.WalkDir(f, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := compareFile(layers, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "couldn't walk overlay")
+	}
+
+	lowest := layers[len(layers)-1]
+	if lowest == nil {
+		return files, nil
+	}
+	if err = fs.WalkDir(lowest, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isWhiteout(name) {
+			return err
+		}
+		if _, err = f.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		file, err := findHidingLayer(layers, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "couldn't walk lowest layer")
+	}
+	slices.SortFunc(files, func(a, b LayeredFile) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return files, nil
+}
+
+func compareFile(layers []fs.FS, name string) (LayeredFile, error) {
+	file := LayeredFile{Path: name, Layer: -1}
+	var upper []byte
+	lowest := len(layers) - 1
+	for i, layer := range layers[:lowest] {
+		if layer == nil {
+			continue
+		}
+		contents, err := fs.ReadFile(layer, name)
+		if err != nil && notExist(layer, name, err) {
+			continue
+		}
+		if err != nil {
+			return LayeredFile{}, errors.Wrapf(err, "couldn't read file %s in layer %d", name, i)
+		}
+		file.Layer = i
+		upper = contents
+		break
+	}
+	if file.Layer < 0 {
+		file.Layer = lowest
+		file.Layering = LayeringInherited
+		return file, nil
+	}
+
+	if layers[lowest] == nil {
+		file.Layering = LayeringAdded
+		return file, nil
+	}
+	lower, err := fs.ReadFile(layers[lowest], name)
+	switch {
+	case err != nil && notExist(layers[lowest], name, err):
+		file.Layering = LayeringAdded
+	case err != nil && isDir(layers[lowest], name):
+		file.Layering = LayeringShadowed // the file shadows a directory
+	case err != nil:
+		return LayeredFile{}, errors.Wrapf(err, "couldn't read file %s in layer %d", name, lowest)
+	case bytes.Equal(upper, lower):
+		file.Layering = LayeringIdentical
+	default:
+		file.Layering = LayeringShadowed
+	}
+	return file, nil
+}
+
+// isDir checks whether the layer has a directory at the named path.
+func isDir(layer fs.FS, name string) bool {
+	info, err := fs.Stat(layer, name)
+	return err == nil && info.IsDir()
+}
+
+// findHidingLayer describes the named file in the lowest layer, which is hidden by an upper layer.
+func findHidingLayer(layers []fs.FS, name string) (LayeredFile, error) {
+	for i, layer := range layers[:len(layers)-1] {
+		if layer == nil {
+			continue
+		}
+		hidden, err := hides(layer, name)
+		if err != nil {
+			return LayeredFile{}, errors.Wrapf(
+				err, "couldn't check for whiteouts of %s in layer %d", name, i,
+			)
+		}
+		if hidden {
+			return LayeredFile{Path: name, Layer: i, Layering: LayeringHidden}, nil
+		}
+	}
+	return LayeredFile{}, errors.Errorf("couldn't find the layer which hides %s", name)
+}
+
+// Set
+
+type Set[Node comparable] map[Node]struct{}
+
+// Add adds the node to the set. If the node was already in the set, nothing changes.
+func (s Set[Node]) Add(n ...Node) {
+	for _, node := range n {
+		s[node] = struct{}{}
+	}
+}
+
+// Has checks whether the node is already in the set.
+func (s Set[Node]) Has(n Node) bool {
+	_, ok := s[n]
+	return ok
+}
+
+// Difference creates a new set with the difference between the set whose method is called and the
+// provided set.
+func (s Set[Node]) Difference(t Set[Node]) Set[Node] {
+	difference := make(Set[Node])
+	for node := range s {
+		if !t.Has(node) {
+			difference.Add(node)
+		}
+	}
+	return difference
+}
+
+// All returns an iterator over all elements in s.
+func (s Set[Node]) All() iter.Seq[Node] {
+	return maps.Keys(s)
+}
@@ -0,0 +1,472 @@
+package overlayfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestLayers() []fs.FS {
+	return []fs.FS{
+		fstest.MapFS{
+			"a.txt":       {Data: []byte("upper a")},
+			"dir/b.txt":   {Data: []byte("upper b")},
+			"dir/sub/c":   {Data: []byte("upper c")},
+			"upper/d.txt": {Data: []byte("upper d")},
+		},
+		nil,
+		fstest.MapFS{
+			"a.txt":       {Data: []byte("lower a")},
+			"dir/b.txt":   {Data: []byte("lower b")},
+			"dir/e.txt":   {Data: []byte("lower e")},
+			"lower/f.txt": {Data: []byte("lower f")},
+			"empty":       {Mode: fs.ModeDir},
+		},
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		layers   []fs.FS
+		file     string
+		contents string
+		err      error
+	}{
+		{name: "upper shadows lower", layers: newTestLayers(), file: "a.txt", contents: "upper a"},
+		{
+			name: "upper shadows lower in dir", layers: newTestLayers(),
+			file: "dir/b.txt", contents: "upper b",
+		},
+		{
+			name: "only in upper", layers: newTestLayers(),
+			file: "upper/d.txt", contents: "upper d",
+		},
+		{
+			name: "only in lower", layers: newTestLayers(),
+			file: "dir/e.txt", contents: "lower e",
+		},
+		{name: "missing", layers: newTestLayers(), file: "g.txt", err: fs.ErrNotExist},
+		{name: "missing dir", layers: newTestLayers(), file: "g/a.txt", err: fs.ErrNotExist},
+		{name: "no layers", file: "a.txt", err: fs.ErrNotExist},
+		{name: "unclean", layers: newTestLayers(), file: "./a.txt", err: fs.ErrInvalid},
+		{name: "rooted", layers: newTestLayers(), file: "/a.txt", err: fs.ErrInvalid},
+		{name: "parent", layers: newTestLayers(), file: "dir/../a.txt", err: fs.ErrInvalid},
+		{name: "trailing slash", layers: newTestLayers(), file: "dir/", err: fs.ErrInvalid},
+		{name: "empty", layers: newTestLayers(), file: "", err: fs.ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(tc.layers...)
+
+			contents, err := f.ReadFile(tc.file)
+			checkRead(t, "ReadFile", string(contents), err, tc.contents, tc.err)
+
+			file, err := f.Open(tc.file)
+			if err == nil {
+				contents, err = io.ReadAll(file)
+				_ = file.Close()
+			}
+			checkRead(t, "Open", string(contents), err, tc.contents, tc.err)
+
+			info, err := f.Stat(tc.file)
+			if err == nil && info.Size() != int64(len(tc.contents)) {
+				t.Errorf("Stat: got size %d, expected %d", info.Size(), len(tc.contents))
+			}
+			checkRead(t, "Stat", tc.contents, err, tc.contents, tc.err)
+		})
+	}
+}
+
+func checkRead(t *testing.T, op, contents string, err error, expected string, expectedErr error) {
+	t.Helper()
+	if expectedErr != nil {
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("%s: got error %v, expected %v", op, err, expectedErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s: unexpected error: %s", op, err)
+		return
+	}
+	if contents != expected {
+		t.Errorf("%s: got contents %q, expected %q", op, contents, expected)
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name    string
+		layers  []fs.FS
+		dir     string
+		entries []string
+		err     error
+	}{
+		{
+			name: "root", layers: newTestLayers(), dir: ".",
+			entries: []string{"a.txt", "dir", "empty", "lower", "upper"},
+		},
+		{
+			name: "merged", layers: newTestLayers(), dir: "dir",
+			entries: []string{"b.txt", "e.txt", "sub"},
+		},
+		{name: "only in upper", layers: newTestLayers(), dir: "dir/sub", entries: []string{"c"}},
+		{name: "only in lower", layers: newTestLayers(), dir: "lower", entries: []string{"f.txt"}},
+		{name: "empty", layers: newTestLayers(), dir: "empty", entries: []string{}},
+		{name: "missing", layers: newTestLayers(), dir: "g", err: fs.ErrNotExist},
+		{name: "unclean", layers: newTestLayers(), dir: "dir/./sub", err: fs.ErrInvalid},
+		{name: "trailing slash", layers: newTestLayers(), dir: "dir/", err: fs.ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(tc.layers...)
+
+			entries, err := f.ReadDir(tc.dir)
+			checkReadDir(t, "ReadDir", entries, err, tc.entries, tc.err)
+
+			// Directories must be merged in the same way when they're opened
+			file, err := f.Open(tc.dir)
+			if err == nil {
+				dir, ok := file.(fs.ReadDirFile)
+				if !ok {
+					t.Fatalf("Open: directory doesn't implement fs.ReadDirFile")
+				}
+				entries, err = dir.ReadDir(-1)
+				_ = file.Close()
+			}
+			checkReadDir(t, "Open", entries, err, tc.entries, tc.err)
+		})
+	}
+}
+
+func checkReadDir(
+	t *testing.T, op string, entries []fs.DirEntry, err error, expected []string, expectedErr error,
+) {
+	t.Helper()
+	if expectedErr != nil {
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("%s: got error %v, expected %v", op, err, expectedErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s: unexpected error: %s", op, err)
+		return
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, expected) {
+		t.Errorf("%s: got entries %q, expected %q", op, names, expected)
+	}
+}
+
+func TestSub(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		layers   []fs.FS
+		dir      string
+		file     string
+		contents string
+		entries  []string
+		err      error
+	}{
+		{
+			name: "root", layers: newTestLayers(), dir: ".", file: "a.txt", contents: "upper a",
+			entries: []string{"a.txt", "dir", "empty", "lower", "upper"},
+		},
+		{
+			name: "merged", layers: newTestLayers(), dir: "dir", file: "e.txt", contents: "lower e",
+			entries: []string{"b.txt", "e.txt", "sub"},
+		},
+		{
+			name: "nested", layers: newTestLayers(), dir: "dir/sub", file: "c", contents: "upper c",
+			entries: []string{"c"},
+		},
+		{name: "unclean", layers: newTestLayers(), dir: "./dir", err: fs.ErrInvalid},
+		{name: "rooted", layers: newTestLayers(), dir: "/dir", err: fs.ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(tc.layers...)
+
+			sub, err := f.Sub(tc.dir)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("got error %v, expected %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			contents, err := sub.ReadFile(tc.file)
+			checkRead(t, "ReadFile", string(contents), err, tc.contents, nil)
+			entries, err := sub.ReadDir(".")
+			checkReadDir(t, "ReadDir", entries, err, tc.entries, nil)
+		})
+	}
+}
+
+func newWhiteoutLayers() []fs.FS {
+	return []fs.FS{
+		fstest.MapFS{
+			".wh.a.txt":              {},
+			"dir/.wh.sub":            {},
+			"opaque/" + OpaqueMarker: {},
+			"opaque/x":               {Data: []byte("upper x")},
+		},
+		fstest.MapFS{
+			"a.txt":     {Data: []byte("lower a")},
+			"dir/b.txt": {Data: []byte("lower b")},
+			"dir/sub/c": {Data: []byte("lower c")},
+			"opaque/x":  {Data: []byte("lower x")},
+			"opaque/y":  {Data: []byte("lower y")},
+		},
+	}
+}
+
+func TestWhiteouts(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		file     string
+		contents string
+		entries  []string
+		err      error
+	}{
+		{name: "root", file: ".", entries: []string{"dir", "opaque"}},
+		{name: "hidden file", file: "a.txt", err: fs.ErrNotExist},
+		{name: "whiteout file", file: ".wh.a.txt", err: fs.ErrNotExist},
+		{name: "dir with hidden dir", file: "dir", entries: []string{"b.txt"}},
+		{name: "hidden dir", file: "dir/sub", err: fs.ErrNotExist},
+		{name: "file in hidden dir", file: "dir/sub/c", err: fs.ErrNotExist},
+		{name: "opaque dir", file: "opaque", entries: []string{"x"}},
+		{name: "file in opaque dir", file: "opaque/x", contents: "upper x"},
+		{name: "hidden file in opaque dir", file: "opaque/y", err: fs.ErrNotExist},
+		{name: "opaque marker", file: "opaque/" + OpaqueMarker, err: fs.ErrNotExist},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := New(newWhiteoutLayers()...)
+
+			if tc.entries != nil {
+				entries, err := f.ReadDir(tc.file)
+				checkReadDir(t, "ReadDir", entries, err, tc.entries, tc.err)
+
+				// Whiteouts must not be listed when directories are opened
+				file, err := f.Open(tc.file)
+				if err != nil {
+					t.Fatalf("Open: unexpected error: %s", err)
+				}
+				defer func() { _ = file.Close() }()
+				dir, ok := file.(fs.ReadDirFile)
+				if !ok {
+					t.Fatalf("Open: directory doesn't implement fs.ReadDirFile")
+				}
+				entries, err = dir.ReadDir(-1)
+				checkReadDir(t, "Open", entries, err, tc.entries, tc.err)
+				return
+			}
+
+			contents, err := f.ReadFile(tc.file)
+			checkRead(t, "ReadFile", string(contents), err, tc.contents, tc.err)
+			_, err = f.Stat(tc.file)
+			checkRead(t, "Stat", tc.contents, err, tc.contents, tc.err)
+			_, err = f.ReadDir(tc.file)
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("ReadDir: got error %v, expected %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCompareWhiteouts(t *testing.T) {
+	t.Parallel()
+	files, err := New(newWhiteoutLayers()...).Compare()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []LayeredFile{
+		{Path: "a.txt", Layer: 0, Layering: LayeringHidden},
+		{Path: "dir/b.txt", Layer: 1, Layering: LayeringInherited},
+		{Path: "dir/sub/c", Layer: 0, Layering: LayeringHidden},
+		{Path: "opaque/x", Layer: 0, Layering: LayeringShadowed},
+		{Path: "opaque/y", Layer: 0, Layering: LayeringHidden},
+	}
+	if !slices.Equal(files, expected) {
+		t.Errorf("got files %+v, expected %+v", files, expected)
+	}
+}
+
+func newFileOverDirLayers() []fs.FS {
+	return []fs.FS{
+		fstest.MapFS{
+			"dir": {Data: []byte("upper dir")},
+		},
+		fstest.MapFS{
+			"a.txt":     {Data: []byte("lower a")},
+			"dir/b.txt": {Data: []byte("lower b")},
+			"dir/sub/c": {Data: []byte("lower c")},
+		},
+	}
+}
+
+// dirLayers copies the layers into directories of the host operating system, and makes a layer for
+// each directory.
+func dirLayers(t *testing.T, layers []fs.FS) []fs.FS {
+	t.Helper()
+	dirs := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		dir := t.TempDir()
+		if err := os.CopyFS(dir, layer); err != nil {
+			t.Fatalf("couldn't copy layer: %s", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return DirLayers(dirs)
+}
+
+func TestFileHidesDir(t *testing.T) {
+	t.Parallel()
+	for _, layers := range []struct {
+		name   string
+		layers func(t *testing.T) []fs.FS
+	}{
+		{
+			name:   "map",
+			layers: func(*testing.T) []fs.FS { return newFileOverDirLayers() },
+		},
+		{
+			// Unlike fstest.MapFS, os.DirFS reports ENOTDIR for paths under files
+			name:   "dir",
+			layers: func(t *testing.T) []fs.FS { return dirLayers(t, newFileOverDirLayers()) },
+		},
+	} {
+		for _, tc := range []struct {
+			name     string
+			file     string
+			contents string
+			entries  []string
+			err      error
+		}{
+			{name: "root", file: ".", entries: []string{"a.txt", "dir"}},
+			{name: "file", file: "dir", contents: "upper dir"},
+			{name: "file under file", file: "dir/b.txt", err: fs.ErrNotExist},
+			{name: "dir under file", file: "dir/sub", err: fs.ErrNotExist},
+			{name: "file in dir under file", file: "dir/sub/c", err: fs.ErrNotExist},
+		} {
+			t.Run(layers.name+"/"+tc.name, func(t *testing.T) {
+				t.Parallel()
+				f := New(layers.layers(t)...)
+
+				if tc.entries != nil {
+					entries, err := f.ReadDir(tc.file)
+					checkReadDir(t, "ReadDir", entries, err, tc.entries, tc.err)
+					return
+				}
+				contents, err := f.ReadFile(tc.file)
+				checkRead(t, "ReadFile", string(contents), err, tc.contents, tc.err)
+				_, err = f.Stat(tc.file)
+				checkRead(t, "Stat", tc.contents, err, tc.contents, tc.err)
+				file, err := f.Open(tc.file)
+				checkRead(t, "Open", tc.contents, err, tc.contents, tc.err)
+				if err == nil {
+					_ = file.Close()
+				}
+				if tc.err != nil {
+					_, err = f.ReadDir(tc.file)
+					checkRead(t, "ReadDir", "", err, "", tc.err)
+				}
+			})
+		}
+
+		t.Run(layers.name+"/sub", func(t *testing.T) {
+			t.Parallel()
+			sub, err := New(layers.layers(t)...).Sub("dir")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err = sub.ReadFile("b.txt")
+			checkRead(t, "ReadFile", "", err, "", fs.ErrNotExist)
+		})
+		t.Run(layers.name+"/compare", func(t *testing.T) {
+			t.Parallel()
+			files, err := New(layers.layers(t)...).Compare()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected := []LayeredFile{
+				{Path: "a.txt", Layer: 1, Layering: LayeringInherited},
+				{Path: "dir", Layer: 0, Layering: LayeringShadowed},
+				{Path: "dir/b.txt", Layer: 0, Layering: LayeringHidden},
+				{Path: "dir/sub/c", Layer: 0, Layering: LayeringHidden},
+			}
+			if !slices.Equal(files, expected) {
+				t.Errorf("got files %+v, expected %+v", files, expected)
+			}
+		})
+	}
+}
+
+func TestStack(t *testing.T) {
+	t.Parallel()
+	layers := newTestLayers()
+	f := New(New(layers[0]), layers[1], New(layers[2]))
+	if stackLayers := f.StackLayers(); len(stackLayers) != len(layers) {
+		t.Fatalf("got %d stack layers, expected %d", len(stackLayers), len(layers))
+	}
+	contents, err := f.ReadFile("a.txt")
+	checkRead(t, "ReadFile", string(contents), err, "upper a", nil)
+	entries, err := f.ReadDir("dir")
+	checkReadDir(t, "ReadDir", entries, err, []string{"b.txt", "e.txt", "sub"}, nil)
+}
+
+func TestFSConformance(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		layers   []fs.FS
+		expected []string
+	}{
+		{
+			name:     "single layer",
+			layers:   newTestLayers()[2:],
+			expected: []string{"a.txt", "dir/b.txt", "dir/e.txt", "empty", "lower/f.txt"},
+		},
+		{
+			name:   "merged",
+			layers: newTestLayers(),
+			expected: []string{
+				"a.txt", "dir/b.txt", "dir/e.txt", "dir/sub/c", "empty", "lower/f.txt",
+				"upper/d.txt",
+			},
+		},
+		{
+			name:     "whiteouts",
+			layers:   newWhiteoutLayers(),
+			expected: []string{"dir/b.txt", "opaque/x"},
+		},
+		{
+			name:     "file over dir",
+			layers:   newFileOverDirLayers(),
+			expected: []string{"a.txt", "dir"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := fstest.TestFS(New(tc.layers...), tc.expected...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/carlmjohnson/versioninfo"
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli/v3"
 
 	"github.com/openUC2/device-portal/internal/app/server"
 	"github.com/openUC2/device-portal/internal/app/server/conf"
+	"github.com/openUC2/device-portal/internal/app/server/logging"
+	"github.com/openUC2/device-portal/internal/clients/certs"
+	"github.com/openUC2/device-portal/internal/clients/templates"
+	"github.com/openUC2/device-portal/internal/overlayfs"
 )
 
 func main() {
@@ -23,59 +30,300 @@ func main() {
 	}
 }
 
-const (
-	defaultPort            = 3001
-	defaultShutdownTimeout = 5 * time.Second
-)
-
 var cmd = &cli.Command{
 	Name:    "device-portal",
 	Version: toolVersion,
 	Usage:   "Provides a landing page",
 	Action:  serverMain,
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "path of a TOML or YAML config file",
+			Sources: cli.EnvVars("CONFIG_PATH"),
+		},
+		// Logging
+		&cli.StringFlag{
+			Name:    "log-level",
+			Value:   logging.DefaultLevel,
+			Usage:   "minimum level of log messages (debug, info, warn, or error)",
+			Sources: cli.EnvVars("LOG_LEVEL"),
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   string(logging.DefaultFormat),
+			Usage:   "format of log messages (text, json, or logfmt)",
+			Sources: cli.EnvVars("LOG_FORMAT"),
+		},
 		// HTTP server
 		&cli.IntFlag{
 			Name:    "http-port",
-			Value:   defaultPort,
+			Value:   conf.DefaultHTTPPort,
 			Usage:   "port for HTTP server",
 			Sources: cli.EnvVars("HTTP_PORT"),
 		},
 		&cli.StringFlag{
 			Name:    "http-base-path",
-			Value:   "/",
+			Value:   conf.DefaultHTTPBasePath,
 			Usage:   "base path for HTTP routes",
 			Sources: cli.EnvVars("HTTP_BASEPATH"),
 		},
 		&cli.IntFlag{
 			Name:    "http-gzip-level",
-			Value:   1,
-			Usage:   "port for HTTP server",
+			Value:   conf.DefaultHTTPGzipLevel,
+			Usage:   "gzip compression level for HTTP responses",
 			Sources: cli.EnvVars("HTTP_GZIPLEVEL"),
 		},
+		&cli.StringSliceFlag{
+			Name:    "http-trusted-proxies",
+			Usage:   "addresses or CIDR ranges of reverse-proxies whose forwarding headers are trusted",
+			Sources: cli.EnvVars("HTTP_TRUSTEDPROXIES"),
+		},
 		&cli.DurationFlag{
 			Name:    "http-shutdown-timeout",
-			Value:   defaultShutdownTimeout,
+			Value:   conf.DefaultHTTPShutdownTimeout,
 			Usage:   "timeout for graceful shutdown before hard shutdown",
 			Sources: cli.EnvVars("SHUTDOWNTIMEOUT"),
 		},
+		// HTTPS server
+		&cli.StringFlag{
+			Name:    "tls-mode",
+			Value:   string(certs.DefaultMode),
+			Usage:   "source of the HTTPS certificate (none, file, self-signed, or local-ca)",
+			Sources: cli.EnvVars("TLS_MODE"),
+		},
+		&cli.IntFlag{
+			Name:    "https-port",
+			Value:   conf.DefaultHTTPSPort,
+			Usage:   "port for HTTPS server, if a TLS mode is set",
+			Sources: cli.EnvVars("HTTPS_PORT"),
+		},
+		&cli.BoolFlag{
+			Name:    "https-redirect",
+			Usage:   "redirect all HTTP requests to the HTTPS server",
+			Sources: cli.EnvVars("HTTPS_REDIRECT"),
+		},
 	},
+	Commands: []*cli.Command{
+		{
+			Name:  "config",
+			Usage: "Inspects the configuration",
+			Commands: []*cli.Command{
+				{
+					Name: "print",
+					Usage: "Prints the effective configuration, merged from the config file, " +
+						"environment variables, and flags",
+					Action: configPrintMain,
+				},
+			},
+		},
+		{
+			Name:  "templates",
+			Usage: "Works with custom webpage templates",
+			Commands: []*cli.Command{
+				{
+					Name: "check",
+					Usage: "Checks directories of custom templates (overlaid in priority order " +
+						"over the built-in templates) for errors, by parsing all templates and " +
+						"rendering pages with sample data",
+					ArgsUsage: "<directory> [directory...]",
+					Action:    templatesCheckMain,
+				},
+				{
+					Name: "export",
+					Usage: "Writes the built-in templates (or only the specified templates or " +
+						"directories of templates) to a directory, as a starting point for " +
+						"custom templates",
+					ArgsUsage: "<directory> [path...]",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "force",
+							Usage: "replace existing files",
+						},
+					},
+					Action: templatesExportMain,
+				},
+				{
+					Name: "diff",
+					Usage: "Lists the templates in directories of custom templates (overlaid in " +
+						"priority order) which add to, shadow, are identical to, or hide the " +
+						"built-in templates",
+					ArgsUsage: "<directory> [directory...]",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "all",
+							Usage: "also list the built-in templates which aren't overridden",
+						},
+					},
+					Action: templatesDiffMain,
+				},
+			},
+		},
+	},
+}
+
+// applyConfig applies the config file and flags to the environment variables of all settings, and
+// returns the sources of the values of all settings which are set.
+func applyConfig(cmd *cli.Command) (map[string]conf.Source, error) {
+	var file conf.File
+	if path := cmd.String("config"); path != "" {
+		var err error
+		if file, err = conf.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	flagValues := make(map[string]string)
+	for _, s := range conf.Settings {
+		// Flags are also set by their environment variables, which are applied separately
+		if s.Flag == "" || !cmd.IsSet(s.Flag) || !setOnCommandLine(os.Args[1:], s.Flag) {
+			continue
+		}
+		switch value := cmd.Value(s.Flag).(type) {
+		default:
+			flagValues[s.Key] = fmt.Sprint(value)
+		case []string:
+			flagValues[s.Key] = strings.Join(value, ",")
+		}
+	}
+	return conf.Apply(file, flagValues)
+}
+
+// setOnCommandLine checks whether the flag with the specified name is in the command-line
+// arguments.
+func setOnCommandLine(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if flag, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); flag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig applies the config file and flags to the environment variables of all settings, and
+// makes the resulting config.
+func loadConfig(cmd *cli.Command) (config conf.Config, err error) {
+	if _, err = applyConfig(cmd); err != nil {
+		return conf.Config{}, err
+	}
+
+	if config, err = conf.GetConfig(); err != nil {
+		return conf.Config{}, err
+	}
+	config.Version = toolVersion
+	return config, nil
+}
+
+func configPrintMain(_ context.Context, cmd *cli.Command) error {
+	sources, err := applyConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err = conf.GetConfig(); err != nil {
+		return err
+	}
+	return conf.WriteEffective(os.Stdout, sources)
+}
+
+// templatesDirs returns the templates directories specified as arguments, in priority order. Each
+// argument may also be a list of directories, in the same format as the templates path setting.
+func templatesDirs(cmd *cli.Command) ([]string, error) {
+	var dirs []string
+	for _, arg := range cmd.Args().Slice() {
+		dirs = append(dirs, templates.ParsePaths(arg)...)
+	}
+	if len(dirs) == 0 {
+		return nil, errors.New("a templates directory must be specified")
+	}
+	return dirs, nil
+}
+
+func templatesCheckMain(_ context.Context, cmd *cli.Command) error {
+	dirs, err := templatesDirs(cmd)
+	if err != nil {
+		return err
+	}
+	result, err := server.CheckTemplates(dirs)
+	if err != nil {
+		return err
+	}
+	for _, name := range result.Unexecuted {
+		fmt.Printf("%s: not rendered, since it has no sample data\n", name)
+	}
+	for _, problem := range result.Problems {
+		fmt.Println(problem)
+	}
+	if len(result.Problems) > 0 {
+		return errors.Errorf("found %d problems in templates", len(result.Problems))
+	}
+	fmt.Printf("checked %d templates with no problems\n", len(result.Checked))
+	return nil
+}
+
+func templatesExportMain(_ context.Context, cmd *cli.Command) error {
+	dir := cmd.Args().First()
+	if dir == "" {
+		return errors.New("a templates directory must be specified")
+	}
+	result, err := server.ExportTemplates(dir, cmd.Args().Tail(), cmd.Bool("force"))
+	if err != nil {
+		return err
+	}
+	for _, name := range result.Written {
+		fmt.Printf("wrote %s\n", name)
+	}
+	for _, name := range result.Skipped {
+		fmt.Printf("skipped %s, which already exists (use --force to replace it)\n", name)
+	}
+	return nil
+}
+
+func templatesDiffMain(_ context.Context, cmd *cli.Command) error {
+	dirs, err := templatesDirs(cmd)
+	if err != nil {
+		return err
+	}
+	files, err := server.CompareTemplates(dirs)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Layering == overlayfs.LayeringInherited {
+			if cmd.Bool("all") {
+				fmt.Printf("%-9s %s\n", file.Layering, file.Path)
+			}
+			continue
+		}
+		if len(dirs) == 1 {
+			fmt.Printf("%-9s %s\n", file.Layering, file.Path)
+			continue
+		}
+		fmt.Printf("%-9s %s (from %s)\n", file.Layering, file.Path, dirs[file.Layer])
+	}
+	return nil
 }
 
 func serverMain(ctx context.Context, cmd *cli.Command) error {
 	e := echo.New()
 
 	// Get config
-	config, err := conf.GetConfig()
+	config, err := loadConfig(cmd)
 	if err != nil {
 		return err
 	}
-	config.HTTP.Port = cmd.Int("http-port")
-	config.HTTP.BasePath = cmd.String("http-base-path")
-	config.HTTP.GzipLevel = cmd.Int("http-gzip-level")
+
+	// Set up logging
+	l := logging.NewLogger(config.Log, os.Stdout)
+	e.Logger = l
+	e.StdLogger = slog.NewLogLogger(l.Slog().Handler(), slog.LevelError)
+	slog.SetDefault(l.Slog())
 
 	// Prepare server
-	s, err := server.New(config, e.Logger)
+	s, err := server.New(config, l)
 	if err != nil {
 		return err
 	}
@@ -87,17 +335,26 @@ func serverMain(ctx context.Context, cmd *cli.Command) error {
 	ctxRun, cancelRun := signal.NotifyContext(
 		ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT,
 	)
+	finished := make(chan error, 1)
 	go func() {
-		if err = s.Run(e); err != nil {
+		err := s.Run(e)
+		if err != nil {
 			e.Logger.Error(err)
 		}
 		cancelRun()
+		finished <- err
+	}()
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		reloadOnHangup(ctxRun, cmd, s, l)
 	}()
 	<-ctxRun.Done()
 	cancelRun()
+	<-reloaded
 
 	// Shut down server
-	shutdownTimeout := cmd.Duration("http-shutdown-timeout")
+	shutdownTimeout := config.HTTP.ShutdownTimeout
 	ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancelShutdown()
 	e.Logger.Infof("attempting to shut down gracefully within %.1f sec", shutdownTimeout.Seconds())
@@ -107,8 +364,67 @@ func serverMain(ctx context.Context, cmd *cli.Command) error {
 			return closeErr
 		}
 	}
+	// Background workers stop after the http server stops, and some of them need to clean up (e.g.
+	// by sending mDNS goodbye announcements), so we wait for them:
+	// If the server stopped because of an error (e.g. because a port is in use), we exit with that
+	// error
+	var runErr error
+	select {
+	case runErr = <-finished:
+	case <-ctxShutdown.Done():
+		e.Logger.Warn("background workers didn't stop within the shutdown timeout")
+	}
 	e.Logger.Info("finished shutdown")
-	return nil
+	return runErr
+}
+
+// reloadOnHangup reloads the config whenever the process receives SIGHUP, until the context is
+// canceled. The HTTP server keeps running; settings which can't be changed without a restart are
+// only logged.
+func reloadOnHangup(ctx context.Context, cmd *cli.Command, s *server.Server, l *logging.Logger) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			l.Info("reloading config")
+			if err := reloadConfig(cmd, s, l); err != nil {
+				l.Error(errors.Wrap(err, "couldn't reload config, so the previous config is kept"))
+			}
+		}
+	}
+}
+
+// reloadConfig re-reads the config file, logs the changes to the effective config, and reconfigures
+// the server's clients. If the new config is invalid, the previous config is restored.
+func reloadConfig(cmd *cli.Command, s *server.Server, l *logging.Logger) error {
+	previous := conf.Effective()
+	config, err := loadConfig(cmd)
+	if err != nil {
+		if restoreErr := conf.Restore(previous); restoreErr != nil {
+			l.Error(errors.Wrap(restoreErr, "couldn't restore previous config"))
+		}
+		return err
+	}
+
+	changes := conf.Diff(previous, conf.Effective())
+	if len(changes) == 0 {
+		l.Info("reloaded config with no changes")
+		return nil
+	}
+	for _, change := range changes {
+		if !change.Setting.Reloadable {
+			l.Warnf("changed %s (takes effect after a restart)", change)
+			continue
+		}
+		l.Infof("changed %s", change)
+	}
+	l.SetSlogLevel(config.Log.Level)
+	return s.Globals.Reload()
 }
 
 // Versioning
@@ -1 +1,3 @@
-export {};
+import { registerStreamSource } from './streams.js';
+
+registerStreamSource();
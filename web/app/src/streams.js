@@ -0,0 +1,82 @@
+// A minimal implementation of Turbo's <turbo-stream-source> element, for
+// receiving Turbo Streams messages over server-sent events without depending on
+// all of Turbo.
+
+function applyStreamAction(stream) {
+  const action = stream.getAttribute('action');
+  if (action === 'refresh') {
+    window.location.reload();
+    return;
+  }
+
+  const template = stream.querySelector('template');
+  const fragment = template
+    ? template.content
+    : document.createDocumentFragment();
+  let targets = [];
+  if (stream.hasAttribute('targets')) {
+    targets = Array.from(
+      document.querySelectorAll(stream.getAttribute('targets')),
+    );
+  } else if (stream.hasAttribute('target')) {
+    const target = document.getElementById(stream.getAttribute('target'));
+    targets = target ? [target] : [];
+  }
+
+  targets.forEach((target) => {
+    const content = fragment.cloneNode(true);
+    switch (action) {
+      case 'append':
+        target.append(content);
+        break;
+      case 'prepend':
+        target.prepend(content);
+        break;
+      case 'replace':
+        target.replaceWith(content);
+        break;
+      case 'update':
+        target.replaceChildren(content);
+        break;
+      case 'remove':
+        target.remove();
+        break;
+      case 'before':
+        target.before(content);
+        break;
+      case 'after':
+        target.after(content);
+        break;
+      default:
+        console.warn(`unknown turbo stream action ${action}`);
+    }
+  });
+}
+
+function renderStreamMessage(html) {
+  const container = document.createElement('template');
+  container.innerHTML = html;
+  container.content.querySelectorAll('turbo-stream').forEach(applyStreamAction);
+}
+
+class StreamSourceElement extends HTMLElement {
+  connectedCallback() {
+    this.source = new EventSource(this.getAttribute('src'));
+    this.source.addEventListener('message', (event) =>
+      renderStreamMessage(event.data),
+    );
+  }
+
+  disconnectedCallback() {
+    if (this.source) {
+      this.source.close();
+      this.source = null;
+    }
+  }
+}
+
+export function registerStreamSource() {
+  if (customElements.get('turbo-stream-source') === undefined) {
+    customElements.define('turbo-stream-source', StreamSourceElement);
+  }
+}